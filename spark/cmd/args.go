@@ -0,0 +1,14 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/names"
+)
+
+// sparkNameArg requires exactly one argument and validates it as a spark name.
+func sparkNameArg(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(1)(cmd, args); err != nil {
+		return err
+	}
+	return names.Validate(args[0])
+}
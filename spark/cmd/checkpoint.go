@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/names"
+)
+
+var dbRollbackYes bool
+
+var dbCheckpointCmd = &cobra.Command{
+	Use:   "checkpoint [spark-name] [label]",
+	Short: "Save a named copy of a spark's database",
+	Long: `Save a server-side copy of a spark's database that can later be restored
+with 'spark db rollback'. The label defaults to the current UTC time.
+
+Postgres can only copy a database with no open sessions, so connections from
+the spark to its database are closed while the checkpoint is taken.
+
+Examples:
+  spark db checkpoint brave-dolphin
+  spark db checkpoint brave-dolphin before-migration`,
+	Args: checkpointArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		label := time.Now().UTC().Format("20060102-150405")
+		if len(args) > 1 {
+			label = args[1]
+		}
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dbClient, err := newDBClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer dbClient.Close()
+
+		fmt.Printf("Creating checkpoint %s of %s...\n", label, sparkName)
+		err = dbClient.CreateCheckpoint(sparkName, label)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Checkpoint %s created\n", label)
+		fmt.Printf("Restore it with: spark db rollback %s %s\n", sparkName, label)
+		return nil
+	},
+}
+
+var dbCheckpointsCmd = &cobra.Command{
+	Use:   "checkpoints [spark-name]",
+	Short: "List the saved checkpoints of a spark's database",
+	Args:  sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dbClient, err := newDBClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer dbClient.Close()
+
+		checkpoints, err := dbClient.ListCheckpoints(sparkName)
+		if err != nil {
+			return err
+		}
+
+		if len(checkpoints) == 0 {
+			fmt.Printf("No checkpoints found for %s\n", sparkName)
+			return nil
+		}
+
+		fmt.Printf("Checkpoints for %s (%d):\n\n", sparkName, len(checkpoints))
+		for _, checkpoint := range checkpoints {
+			created := "unknown"
+			if !checkpoint.CreatedAt.IsZero() {
+				created = checkpoint.CreatedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  - %s (created %s, %s)\n", checkpoint.Label, created, formatBytes(checkpoint.SizeBytes))
+		}
+
+		return nil
+	},
+}
+
+var dbRollbackCmd = &cobra.Command{
+	Use:   "rollback [spark-name] [label]",
+	Short: "Restore a spark's database from a checkpoint",
+	Long: `Replace a spark's database with a copy of a saved checkpoint. The
+checkpoint is kept, and the replaced database is saved as the "pre-rollback"
+checkpoint so the rollback itself can be undone.
+
+Connections from the spark to its database are closed during the rollback.
+
+Examples:
+  spark db rollback brave-dolphin before-migration
+  spark db rollback brave-dolphin pre-rollback   # Undo the last rollback`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+			return err
+		}
+		if err := names.Validate(args[0]); err != nil {
+			return err
+		}
+		return names.ValidateCheckpointRef(args[1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		label := args[1]
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dbClient, err := newDBClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer dbClient.Close()
+
+		if !dbRollbackYes && !confirm(fmt.Sprintf("Replace the database of %s with checkpoint %s?", sparkName, label)) {
+			fmt.Println("Aborted")
+			return nil
+		}
+
+		fmt.Printf("Rolling back %s to checkpoint %s...\n", sparkName, label)
+		err = dbClient.RollbackCheckpoint(sparkName, label)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("✓ Database restored from checkpoint %s\n", label)
+		return nil
+	},
+}
+
+// checkpointArgs accepts a spark name and an optional checkpoint label.
+func checkpointArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.RangeArgs(1, 2)(cmd, args); err != nil {
+		return err
+	}
+	if err := names.Validate(args[0]); err != nil {
+		return err
+	}
+	if len(args) > 1 {
+		return names.ValidateCheckpointLabel(args[1])
+	}
+	return nil
+}
+
+// formatBytes renders a byte count in human-readable binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func init() {
+	dbCmd.AddCommand(dbCheckpointCmd)
+	dbCmd.AddCommand(dbCheckpointsCmd)
+	dbCmd.AddCommand(dbRollbackCmd)
+	dbRollbackCmd.Flags().BoolVarP(&dbRollbackYes, "yes", "y", false, "Roll back without asking")
+}
@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
+)
+
+// vscodeEditors are editors opening remote folders the way VS Code does.
+var vscodeEditors = map[string]bool{
+	"code":          true,
+	"code-insiders": true,
+	"cursor":        true,
+	"windsurf":      true,
+}
+
+var codeEditor string
+
+var codeCmd = &cobra.Command{
+	Use:   "code [spark-name] [path]",
+	Short: "Open a spark in a local editor",
+	Long: `Open a directory inside a spark in a local editor over SSH. The path
+defaults to /home/user/project for sparks created with --repo and to
+/home/user otherwise, and is relative to /home/user unless absolute.
+
+The spark's host key is pinned first, so the editor connects without
+prompts. If ~/.ssh/config has the block managed by 'spark ssh-config
+--write', the spark's entry in it is added or refreshed and the editor
+connects through it; otherwise spark asks before adding the block, and
+without it the editor connects to user@<tailnet hostname> with your default
+SSH keys.
+
+The editor is --editor, or SPARK_EDITOR, or code. VS Code and its forks
+(code, code-insiders, cursor, windsurf) open the folder with Remote-SSH and
+zed opens it over ssh://. Any other value is run as a command, with {host}
+and {path} (an absolute path) replaced, or with <host>:<path> appended if it
+has neither.
+
+Examples:
+  spark code brave-dolphin
+  spark code brave-dolphin api --editor zed
+  SPARK_EDITOR='nvim scp://{host}/{path}/' spark code brave-dolphin`,
+	Args: codeArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		deployment, err := k8sClient.GetDeployment(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+		if deployment.Status.ReadyReplicas == 0 {
+			fmt.Printf("Warning: %s is not ready yet, the editor may fail to connect\n", sparkName)
+		}
+
+		dir := sparkHome
+		if len(args) == 2 {
+			dir = args[1]
+			if !path.IsAbs(dir) {
+				dir = path.Join(sparkHome, dir)
+			}
+		} else if projectDir, err := k8sClient.GetProjectDir(ctx, sparkName); err == nil && projectDir != "" {
+			dir = projectDir
+		}
+
+		host, err := codeHost(ctx, k8sClient, sparkName)
+		if err != nil {
+			return err
+		}
+
+		editor := codeEditor
+		if editor == "" {
+			editor = config.Editor()
+		}
+		editorCmd, err := editorCommand(editor, host, dir)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Opening %s:%s in %s\n", sparkName, dir, editorCmd.Args[0])
+		editorCmd.Stdin = os.Stdin
+		editorCmd.Stdout = os.Stdout
+		editorCmd.Stderr = os.Stderr
+		return editorCmd.Run()
+	},
+}
+
+// codeHost returns the host the editor connects to, pinning the spark's
+// host key. That is the spark's alias if the managed block of ~/.ssh/config
+// exists or the user agrees to add it, with only the spark's entry added or
+// refreshed, and otherwise user@ its tailnet hostname.
+func codeHost(ctx context.Context, k8sClient *k8s.Client, sparkName string) (string, error) {
+	path := sshkeys.SSHConfigPath()
+	entries, found, err := sshkeys.ReadManagedBlock(path)
+	if err != nil {
+		return "", err
+	}
+	if !found && !confirm(fmt.Sprintf("Add %s to a block managed by spark in %s?", sparkName, path)) {
+		ensureHostKeyPinned(ctx, k8sClient, sparkName)
+		return sparkUser + "@" + k8s.TailscaleHostname(sparkName), nil
+	}
+
+	entry, err := sshConfigEntry(ctx, k8sClient, sparkName, true)
+	if err != nil {
+		return "", err
+	}
+	replaced := false
+	for i := range entries {
+		if entries[i].Name == sparkName {
+			entry.LocalForwards = entries[i].LocalForwards
+			entries[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	if err := sshkeys.WriteManagedBlock(path, entries); err != nil {
+		return "", err
+	}
+	return sparkName, nil
+}
+
+// codeArgs requires a spark name and allows a path.
+func codeArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.RangeArgs(1, 2)(cmd, args); err != nil {
+		return err
+	}
+	return names.Validate(args[0])
+}
+
+// editorCommand returns the command opening dir on host, the spark's
+// ~/.ssh/config alias or user@hostname, in editor.
+func editorCommand(editor, host, dir string) (*exec.Cmd, error) {
+	fields := strings.Fields(editor)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("no editor configured")
+	}
+
+	switch {
+	case len(fields) == 1 && vscodeEditors[fields[0]]:
+		return exec.Command(fields[0], "--folder-uri", fmt.Sprintf("vscode-remote://ssh-remote+%s%s", host, dir)), nil
+	case len(fields) == 1 && fields[0] == "zed":
+		return exec.Command("zed", fmt.Sprintf("ssh://%s%s", host, dir)), nil
+	}
+
+	if !strings.Contains(editor, "{host}") && !strings.Contains(editor, "{path}") {
+		return exec.Command(fields[0], append(fields[1:], host+":"+dir)...), nil
+	}
+	replacer := strings.NewReplacer("{host}", host, "{path}", dir)
+	for i, field := range fields {
+		fields[i] = replacer.Replace(field)
+	}
+	return exec.Command(fields[0], fields[1:]...), nil
+}
+
+func init() {
+	rootCmd.AddCommand(codeCmd)
+	codeCmd.Flags().StringVar(&codeEditor, "editor", "", "Editor to open: code, cursor, zed or a command template (default SPARK_EDITOR or code)")
+}
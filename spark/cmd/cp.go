@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/archive"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// sparkHome is the spark user's home directory, which relative spark paths
+// are resolved against.
+const sparkHome = "/home/user"
+
+// extractScript unpacks a tar archive from stdin into the directory $1,
+// creating it as the spark user if needed. Files keep their archived mode
+// and uid 1000 ownership.
+const extractScript = `set -e
+if [ ! -d "$1" ]; then runuser -u user -- mkdir -p "$1"; fi
+tar -x -p --same-owner --numeric-owner -C "$1" -f -`
+
+var copyExclude []string
+
+var cpCmd = &cobra.Command{
+	Use:   "cp [source] [destination]",
+	Short: "Copy files and directories to and from a spark",
+	Long: `Copy a file or directory between this machine and a spark. Spark paths
+are written as <spark-name>:<path>, relative to /home/user unless absolute.
+
+As with cp, copying onto an existing directory places the source inside it,
+and otherwise the source is copied to the destination path. Files are
+streamed as a tar archive through the Kubernetes API, keep their
+permissions and are owned by the spark user.
+
+Examples:
+  spark cp ./data brave-dolphin:project/          # into /home/user/project/data
+  spark cp brave-dolphin:project/out.csv .
+  spark cp ./app brave-dolphin:app --exclude node_modules --exclude '*.log'`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		srcSpark, srcPath, srcRemote := parseCopyPath(args[0])
+		dstSpark, dstPath, dstRemote := parseCopyPath(args[1])
+		switch {
+		case srcRemote && dstRemote:
+			return fmt.Errorf("copying between sparks is not supported; copy through this machine instead")
+		case !srcRemote && !dstRemote:
+			return fmt.Errorf("one of source or destination must be a spark path (<spark-name>:<path>)")
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		if dstRemote {
+			return copyToSpark(ctx, k8sClient, srcPath, dstSpark, dstPath)
+		}
+		return copyFromSpark(ctx, k8sClient, srcSpark, srcPath, dstPath)
+	},
+}
+
+// parseCopyPath splits a <spark-name>:<path> argument. Anything else, such as
+// ./file or a Windows drive path, is a local path.
+func parseCopyPath(arg string) (sparkName, p string, remote bool) {
+	name, rest, ok := strings.Cut(arg, ":")
+	if !ok || names.Validate(name) != nil {
+		return "", arg, false
+	}
+	if runtime.GOOS == "windows" && len(name) == 1 {
+		return "", arg, false
+	}
+	if rest == "" {
+		rest = sparkHome
+	} else if !path.IsAbs(rest) {
+		rest = path.Join(sparkHome, rest)
+	}
+	return name, rest, true
+}
+
+func copyToSpark(ctx context.Context, k8sClient *k8s.Client, src, sparkName, dst string) error {
+	src, err := filepath.Abs(src)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(src); err != nil {
+		return err
+	}
+
+	dir, name := dst, filepath.Base(src)
+	if isDir, err := remoteIsDir(ctx, k8sClient, sparkName, dst); err != nil {
+		return err
+	} else if !isDir {
+		dir, name = path.Dir(dst), path.Base(dst)
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(archive.Write(writer, src, name, copyExclude))
+	}()
+
+	progress := newCopyProgress()
+	var stderr bytes.Buffer
+	err = k8sClient.Exec(ctx, sparkName, k8s.ExecOptions{
+		Command: []string{"sh", "-c", extractScript, "sh", dir},
+		Stdin:   io.TeeReader(reader, progress),
+		Stdout:  io.Discard,
+		Stderr:  &stderr,
+	})
+	reader.Close()
+	progress.done()
+	if err != nil {
+		return remoteCopyError(err, &stderr)
+	}
+
+	fmt.Printf("Copied %s to %s:%s\n", src, sparkName, path.Join(dir, name))
+	return nil
+}
+
+func copyFromSpark(ctx context.Context, k8sClient *k8s.Client, sparkName, src, dst string) error {
+	dir, name := dst, path.Base(src)
+	if info, err := os.Stat(dst); err != nil || !info.IsDir() {
+		dir, name = filepath.Dir(dst), filepath.Base(dst)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	command := []string{"tar", "-c", "-f", "-", "-C", path.Dir(src)}
+	for _, pattern := range copyExclude {
+		command = append(command, "--exclude="+pattern)
+	}
+	command = append(command, path.Base(src))
+
+	reader, writer := io.Pipe()
+	extracted := make(chan error, 1)
+	go func() {
+		err := archive.Extract(reader, dir, name)
+		// Drain anything left so the remote tar isn't blocked writing
+		_, _ = io.Copy(io.Discard, reader)
+		extracted <- err
+	}()
+
+	progress := newCopyProgress()
+	var stderr bytes.Buffer
+	err := k8sClient.Exec(ctx, sparkName, k8s.ExecOptions{
+		Command: command,
+		Stdout:  io.MultiWriter(writer, progress),
+		Stderr:  &stderr,
+	})
+	writer.CloseWithError(err)
+	extractErr := <-extracted
+	progress.done()
+	if err != nil {
+		return remoteCopyError(err, &stderr)
+	}
+	if extractErr != nil {
+		return fmt.Errorf("failed to extract files: %w", extractErr)
+	}
+
+	fmt.Printf("Copied %s:%s to %s\n", sparkName, src, filepath.Join(dir, name))
+	return nil
+}
+
+// remoteIsDir reports whether p is an existing directory in the spark.
+func remoteIsDir(ctx context.Context, k8sClient *k8s.Client, sparkName, p string) (bool, error) {
+	err := k8sClient.Exec(ctx, sparkName, k8s.ExecOptions{
+		Command: []string{"test", "-d", p},
+		// The exec API requires at least one stream
+		Stderr: io.Discard,
+	})
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// remoteCopyError reports a failed remote tar with what it printed.
+func remoteCopyError(err error, stderr *bytes.Buffer) error {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) && stderr.Len() > 0 {
+		return fmt.Errorf("copy failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return fmt.Errorf("copy failed: %w", err)
+}
+
+// copyProgress prints the number of bytes transferred to stderr, at most a
+// few times a second.
+type copyProgress struct {
+	total   int64
+	start   time.Time
+	printed time.Time
+}
+
+func newCopyProgress() *copyProgress {
+	return &copyProgress{start: time.Now()}
+}
+
+func (p *copyProgress) Write(b []byte) (int, error) {
+	p.total += int64(len(b))
+	if time.Since(p.printed) > 200*time.Millisecond {
+		p.printed = time.Now()
+		fmt.Fprintf(os.Stderr, "\r%s transferred", formatBytes(p.total))
+	}
+	return len(b), nil
+}
+
+func (p *copyProgress) done() {
+	fmt.Fprintf(os.Stderr, "\r%s transferred in %s\n", formatBytes(p.total), time.Since(p.start).Round(100*time.Millisecond))
+}
+
+func init() {
+	rootCmd.AddCommand(cpCmd)
+	cpCmd.Flags().StringArrayVar(&copyExclude, "exclude", nil, "Skip files matching a pattern, by name or path relative to the source (repeatable)")
+}
@@ -4,27 +4,83 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/t-eckert/homelab/spark/internal/config"
 	"github.com/t-eckert/homelab/spark/internal/db"
+	"github.com/t-eckert/homelab/spark/internal/devcontainer"
 	"github.com/t-eckert/homelab/spark/internal/k8s"
 	"github.com/t-eckert/homelab/spark/internal/names"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
+	"github.com/t-eckert/homelab/spark/internal/templates"
 )
 
-var gitRepo string
+var (
+	createDBLimits limitFlags
+	dbFrom         string
+	maskRulesPath  string
+	templateName   string
+	noDevcontainer bool
+	createImage    string
+	createNix      bool
+)
 
 var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Create a new spark dev environment",
 	Long: `Create a new spark dev environment with:
 - Random adjective-noun name
-- Debian container with SSH, Claude Code, and dotfiles
+- Container built from a template (Debian with common tools by default),
+  with SSH, Claude Code, and dotfiles
 - Tailscale connectivity
 - Dedicated PostgreSQL database
-- Pre-configured environment variables`,
+- Pre-configured environment variables
+
+Examples:
+  spark create --template go-api
+  spark create --template python-data --repo https://github.com/me/notebooks
+  spark create --repo https://github.com/me/api@main --repo https://github.com/me/web:web
+
+Repositories are given as url[@ref][:path]. The first is cloned into
+/home/user/project unless given a path, the others into /home/user/<name>.
+Private GitHub repositories clone with GITHUB_TOKEN. Failed clones are
+reported as failed setup steps rather than stopping the spark.
+
+See 'spark templates' for the available templates.
+
+When the first --repo repository has a .devcontainer/devcontainer.json, its image,
+environment variables, forwarded ports, lifecycle commands and common
+features are applied on top of the template. A summary shows what was
+applied and what was ignored; use --no-devcontainer to skip it.
+
+--image replaces the base image. Debian, Ubuntu, Alpine and Fedora based
+images get the packages they need installed on boot; images containing
+/etc/spark/image are prebuilt spark images and skip package installation.
+
+Dotfiles, the git author, the GitHub user and the login shell come from
+~/.config/spark/config.yaml and the local git config, and can be
+overridden with --dotfiles, --git-name, --git-email, --github-user and
+--shell.
+
+--size picks a CPU and memory preset: small (500m, 1Gi), medium (1 CPU,
+2Gi), large (2 CPUs, 4Gi), xl (4 CPUs, 16Gi) or one defined in
+~/.config/spark/config.yaml. --cpu and --memory override it. Without them
+the template's resources apply, or medium. The size must fit in the spark
+namespace's resource quotas and on a node; change it later with 'spark
+resize'.
+
+--nix installs Nix, keeping /nix on the spark's volume. When the first
+repository has a flake.nix, SSH sessions start in it and direnv enters its
+devShell, built in the background on boot.
+
+--env, --env-file and --secret-env set environment variables, kept in the
+spark's Secret or referencing existing Secrets; see 'spark env'.
+
+Hook scripts in ~/.config/spark/hooks and the repository's .spark/hooks,
+named pre-setup, post-setup or on-start, run as user on every boot.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := context.Background()
 
@@ -34,8 +90,78 @@ var createCmd = &cobra.Command{
 			return fmt.Errorf("failed to load config: %w", err)
 		}
 
+		// Resolve the template and read its seeds before creating anything
+		template, err := loadTemplate(templateName)
+		if err != nil {
+			return err
+		}
+		seeds, err := template.Seeds()
+		if err != nil {
+			return err
+		}
+		repos, err := createRepos.resolve()
+		if err != nil {
+			return err
+		}
+		var devcontainerPlan *devcontainer.Plan
+		if len(repos) > 0 && !noDevcontainer {
+			workDir := (&k8s.SparkResources{Repos: repos}).WorkDir()
+			devcontainerPlan = loadDevcontainer(ctx, repos[0], workDir)
+			if err := checkEnvironment(template, devcontainerPlan); err != nil {
+				return err
+			}
+		}
+
+		hooks, err := loadHooks()
+		if err != nil {
+			return err
+		}
+		userEnv, secretEnv, err := createEnv.collect()
+		if err != nil {
+			return err
+		}
+		identity, err := createIdentity.resolve(cfg.Identity)
+		if err != nil {
+			return err
+		}
+		cpu, memory, err := createSize.resolve(cfg.Sizes)
+		if err != nil {
+			return err
+		}
+
+		// Load masking rules up front so mistakes fail before anything is created
+		var maskRules *db.MaskRules
+		if maskRulesPath != "" {
+			if dbFrom == "" {
+				return fmt.Errorf("--mask requires --db-from")
+			}
+			maskRules, err = db.LoadMaskRules(maskRulesPath)
+			if err != nil {
+				return err
+			}
+		}
+		if dbFrom != "" {
+			if err := checkMaskRules(cfg, dbFrom, maskRules); err != nil {
+				return err
+			}
+		}
+
+		// Gather authorized keys up front too, since fetching from GitHub can fail
+		authorizedKeys, err := sshkeys.ParseAuthorizedKeys(cfg.SSHPublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid SSH public key: %w", err)
+		}
+		extraKeys, err := createKeys.collect(ctx)
+		if err != nil {
+			return err
+		}
+		authorizedKeys = sshkeys.MergeAuthorizedKeys(authorizedKeys, extraKeys...)
+
 		// Generate random name
 		sparkName := names.Generate()
+		if err := names.Validate(sparkName); err != nil {
+			return err
+		}
 		fmt.Printf("Creating spark: %s\n", sparkName)
 
 		// Create PostgreSQL database
@@ -58,6 +184,33 @@ var createCmd = &cobra.Command{
 		}
 		fmt.Printf("Database created: %s\n", sparkName)
 
+		// Apply database limits so one spark cannot starve the shared server
+		limits := defaultLimits(cfg)
+		createDBLimits.apply(cmd.Flags(), "db-", limits)
+		err = dbClient.SetLimits(sparkName, *limits)
+		if err != nil {
+			_ = dbClient.DeleteDatabase(sparkName)
+			return fmt.Errorf("failed to set database limits: %w", err)
+		}
+
+		// Clone an application database into the spark's database
+		if dbFrom != "" {
+			err = cloneDatabase(cfg, dbFrom, sparkName, maskRules)
+			if err != nil {
+				_ = dbClient.DeleteDatabase(sparkName)
+				return fmt.Errorf("failed to clone database %s: %w", dbFrom, err)
+			}
+		}
+
+		// Seed the database from the template
+		if len(seeds) > 0 {
+			err = seedDatabase(cfg, sparkName, seeds)
+			if err != nil {
+				_ = dbClient.DeleteDatabase(sparkName)
+				return fmt.Errorf("failed to seed database: %w", err)
+			}
+		}
+
 		// Build database URL for the spark (URI format with password for container use)
 		sparkDBURL := db.BuildConnectionURI(
 			cfg.PostgresHost,
@@ -74,13 +227,47 @@ var createCmd = &cobra.Command{
 			return fmt.Errorf("failed to create k8s client: %w", err)
 		}
 
+		// Generate the spark's SSH host key once so it survives restarts
+		hostKey, err := sshkeys.GenerateHostKey()
+		if err != nil {
+			_ = dbClient.DeleteDatabase(sparkName)
+			return err
+		}
+
 		resources := &k8s.SparkResources{
 			Name:            sparkName,
-			GitRepo:         gitRepo,
 			DatabaseURL:     sparkDBURL,
 			AnthropicAPIKey: cfg.AnthropicAPIKey,
-			SSHPublicKey:    cfg.SSHPublicKey,
+			SSHPublicKey:    sshkeys.FormatAuthorizedKeys(authorizedKeys),
 			GitHubToken:     cfg.GitHubToken,
+			HostPrivateKey:  hostKey.PrivateKey,
+			HostPublicKey:   hostKey.PublicKey,
+			UserEnv:         userEnv,
+			SecretEnv:       secretEnv,
+			Hooks:           hooks,
+		}
+		applyTemplate(resources, template)
+		applyIdentity(resources, identity)
+		createRepos.apply(resources, repos)
+		if devcontainerPlan != nil {
+			applyDevcontainer(resources, devcontainerPlan)
+		}
+		if createImage != "" {
+			resources.Image = createImage
+		}
+		resources.Nix = createNix
+		// Size flags win over the template, which wins over the default size
+		if resources.CPU == "" {
+			resources.CPU = cfg.Sizes[config.DefaultSize].CPU
+		}
+		if resources.Memory == "" {
+			resources.Memory = cfg.Sizes[config.DefaultSize].Memory
+		}
+		if cpu != "" {
+			resources.CPU = cpu
+		}
+		if memory != "" {
+			resources.Memory = memory
 		}
 
 		err = k8sClient.CreateSpark(ctx, resources)
@@ -90,6 +277,9 @@ var createCmd = &cobra.Command{
 			return fmt.Errorf("failed to create spark: %w", err)
 		}
 
+		pinHostKey(sparkName, hostKey.PublicKey)
+		refreshSSHConfig(ctx, k8sClient)
+
 		fmt.Printf("Spark created successfully!\n")
 		fmt.Printf("\nWaiting for pod to be ready...\n")
 
@@ -113,26 +303,48 @@ var createCmd = &cobra.Command{
 		}
 
 		fmt.Printf("✓ Pod is ready!\n")
+
+		// Follow the init script so failed steps, such as cloning a
+		// repository without access to it, are reported here
+		fmt.Printf("\nSetting up spark...\n")
+		if failed := followSetup(ctx, k8sClient, sparkName); len(failed) > 0 {
+			fmt.Printf("✗ %d setup step(s) failed, see: kubectl logs -n %s deploy/%s -c %s\n", len(failed), k8s.SparkNamespace, sparkName, k8s.SparkContainer)
+		} else {
+			fmt.Printf("✓ Spark is set up!\n")
+		}
 		fmt.Printf("\nSpark Details:\n")
 		fmt.Printf("  Name:     %s\n", sparkName)
+		fmt.Printf("  Template: %s\n", template.Name)
+		fmt.Printf("  Image:    %s\n", resources.ImageName())
+		fmt.Printf("  Size:     %s CPU, %s memory\n", resources.CPU, resources.Memory)
 		fmt.Printf("  Database: %s\n", sparkName)
 		fmt.Printf("  SSH:      ssh user@spark-%s\n", sparkName)
-		if gitRepo != "" {
-			fmt.Printf("  Git Repo: %s\n", gitRepo)
+		for _, repo := range repos {
+			fmt.Printf("  Git Repo: %s\n", repo)
+		}
+		if resources.DotfilesRepo != "" {
+			fmt.Printf("  Dotfiles: %s\n", resources.DotfilesRepo)
+		}
+		if resources.GitName != "" || resources.GitEmail != "" {
+			fmt.Printf("  Git:      %s <%s>\n", resources.GitName, resources.GitEmail)
+		}
+		if len(userEnv)+len(secretEnv) > 0 {
+			fmt.Printf("  Env:      %d variable(s), see 'spark env list %s'\n", len(userEnv)+len(secretEnv), sparkName)
+		}
+		if dbFrom != "" {
+			fmt.Printf("  Cloned:   %s\n", dbFrom)
+		}
+		if len(resources.ForwardPorts) > 0 {
+			fmt.Printf("  Forward:  spark forward %s  # ports %s\n", sparkName, strings.Join(resources.ForwardPorts, ", "))
 		}
 
 		fmt.Printf("\nConnecting to spark...\n")
 
 		// SSH into the spark
-		sshCmd := exec.Command("ssh", fmt.Sprintf("user@spark-%s", sparkName))
-		sshCmd.Stdin = os.Stdin
-		sshCmd.Stdout = os.Stdout
-		sshCmd.Stderr = os.Stderr
-
-		err = sshCmd.Run()
+		err = connectToSpark(ctx, k8sClient, sparkName)
 		if err != nil {
 			fmt.Printf("\nFailed to SSH into spark: %v\n", err)
-			fmt.Printf("You can try connecting manually with: ssh user@spark-%s\n", sparkName)
+			fmt.Printf("You can try connecting again with: spark shell %s\n", sparkName)
 		}
 
 		return nil
@@ -141,5 +353,123 @@ var createCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(createCmd)
-	createCmd.Flags().StringVarP(&gitRepo, "repo", "r", "", "Git repository to clone into the spark")
+	createRepos.register(createCmd.Flags())
+	createCmd.Flags().StringVar(&createImage, "image", "", "Base image, overriding the template and devcontainer.json (Debian, Ubuntu, Alpine, Fedora or a prebuilt spark image)")
+	createCmd.Flags().BoolVar(&createNix, "nix", false, "Install Nix and enter the repository's flake devShell with direnv")
+	createCmd.Flags().BoolVar(&noDevcontainer, "no-devcontainer", false, "Ignore the repository's devcontainer.json")
+	createCmd.Flags().StringVarP(&templateName, "template", "t", templates.Default, "Template describing the spark's environment (see 'spark templates list')")
+	createDBLimits.register(createCmd.Flags(), "db-")
+	createKeys.register(createCmd.Flags())
+	createEnv.register(createCmd.Flags())
+	createIdentity.register(createCmd.Flags())
+	createSize.register(createCmd.Flags())
+	addSSHFlags(createCmd)
+	createCmd.Flags().StringVar(&dbFrom, "db-from", "", "Application database to clone into the spark's database")
+	createCmd.Flags().StringVar(&maskRulesPath, "mask", "", "YAML file of sampling and masking rules for --db-from")
+}
+
+// setupTimeout bounds how long create follows a spark's init script.
+const setupTimeout = 15 * time.Minute
+
+// followSetup prints the steps of the spark's init script as it runs, until
+// sshd starts, and returns the steps that failed.
+func followSetup(ctx context.Context, k8sClient *k8s.Client, sparkName string) []string {
+	ctx, cancel := context.WithTimeout(ctx, setupTimeout)
+	defer cancel()
+
+	var failed []string
+	ready := false
+	err := k8sClient.FollowLog(ctx, sparkName, func(line string) bool {
+		switch {
+		case strings.HasPrefix(line, "==> "):
+			fmt.Printf("  %s\n", strings.TrimPrefix(line, "==> "))
+		case strings.HasPrefix(line, "!!> "):
+			step := strings.TrimPrefix(line, "!!> ")
+			fmt.Printf("  ✗ %s\n", step)
+			failed = append(failed, step)
+		case strings.HasPrefix(line, "Spark is ready!"):
+			ready = true
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		fmt.Printf("Warning: stopped following the spark's setup: %v\n", err)
+	} else if !ready {
+		fmt.Println("Warning: the spark's container stopped before it was ready")
+	}
+	return failed
+}
+
+// loadHooks reads the hook scripts in the config directory's hooks
+// directory, skipping those that don't exist.
+func loadHooks() (map[string]string, error) {
+	hooks := make(map[string]string)
+	for _, name := range k8s.HookNames {
+		path := filepath.Join(config.Dir(), "hooks", name)
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read hook: %w", err)
+		}
+		hooks[name] = string(data)
+	}
+	return hooks, nil
+}
+
+// cloneDatabase copies the source application database into the spark's
+// database, applying the masking rules.
+func cloneDatabase(cfg *config.Config, source, sparkName string, rules *db.MaskRules) error {
+	if rules == nil {
+		fmt.Println("Warning: no --mask rules given, copying all rows and columns unmasked")
+	}
+
+	sourceClient, err := connectSource(cfg, source)
+	if err != nil {
+		return err
+	}
+	defer sourceClient.Close()
+
+	targetClient, err := db.NewClient(db.BuildConnectionString(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresUser,
+		sparkName,
+	), cfg.PostgresPassword)
+	if err != nil {
+		return fmt.Errorf("failed to connect to spark database: %w", err)
+	}
+	defer targetClient.Close()
+
+	fmt.Printf("Cloning database %s...\n", source)
+	return targetClient.CloneFrom(sourceClient, rules, func(msg string) {
+		fmt.Printf("  %s\n", msg)
+	})
+}
+
+// checkMaskRules checks the masking rules against the source database's
+// tables, so a mask that cannot be applied fails before anything is created.
+func checkMaskRules(cfg *config.Config, source string, rules *db.MaskRules) error {
+	sourceClient, err := connectSource(cfg, source)
+	if err != nil {
+		return err
+	}
+	defer sourceClient.Close()
+	return sourceClient.CheckMaskRules(rules)
+}
+
+// connectSource connects to an application database to clone from.
+func connectSource(cfg *config.Config, source string) (*db.Client, error) {
+	sourceClient, err := db.NewClient(db.BuildConnectionString(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.SourcePostgresUser,
+		source,
+	), cfg.SourcePostgresPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to source database: %w", err)
+	}
+	return sourceClient, nil
 }
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/db"
+)
+
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Manage a spark's PostgreSQL database",
+	Long:  `Inspect and manage the PostgreSQL database that belongs to a spark`,
+}
+
+var dbLimitsFlags limitFlags
+
+var dbLimitsCmd = &cobra.Command{
+	Use:   "limits [spark-name]",
+	Short: "Show or change a spark's database limits",
+	Long: `Show the connection limit, statement timeout, idle-in-transaction timeout
+and work_mem applied to a spark's database. Pass any of the flags to change
+them; unchanged settings are kept.
+
+Examples:
+  spark db limits brave-dolphin
+  spark db limits brave-dolphin --connection-limit 20 --statement-timeout 1min`,
+	Args: sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		dbClient, err := newDBClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer dbClient.Close()
+
+		limits, err := dbClient.GetLimits(sparkName)
+		if err != nil {
+			return err
+		}
+
+		if dbLimitsFlags.apply(cmd.Flags(), "", limits) {
+			err = dbClient.SetLimits(sparkName, *limits)
+			if err != nil {
+				return fmt.Errorf("failed to set database limits: %w", err)
+			}
+			fmt.Printf("Database limits updated for %s\n\n", sparkName)
+		}
+
+		printLimits(limits)
+		return nil
+	},
+}
+
+// newDBClient connects to PostgreSQL as the spark user.
+func newDBClient(cfg *config.Config) (*db.Client, error) {
+	dbConnString := db.BuildConnectionString(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresUser,
+		cfg.PostgresDB,
+	)
+	dbClient, err := db.NewClient(dbConnString, cfg.PostgresPassword)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	return dbClient, nil
+}
+
+// defaultLimits returns the database limits configured for new sparks.
+func defaultLimits(cfg *config.Config) *db.Limits {
+	return &db.Limits{
+		ConnectionLimit:          cfg.DBConnectionLimit,
+		StatementTimeout:         cfg.DBStatementTimeout,
+		IdleInTransactionTimeout: cfg.DBIdleInTransactionTimeout,
+		WorkMem:                  cfg.DBWorkMem,
+	}
+}
+
+func printLimits(limits *db.Limits) {
+	connLimit := fmt.Sprintf("%d", limits.ConnectionLimit)
+	if limits.ConnectionLimit < 0 {
+		connLimit = "unlimited"
+	}
+	fmt.Printf("  Connection limit:            %s\n", connLimit)
+	fmt.Printf("  Statement timeout:           %s\n", orDefault(limits.StatementTimeout))
+	fmt.Printf("  Idle-in-transaction timeout: %s\n", orDefault(limits.IdleInTransactionTimeout))
+	fmt.Printf("  work_mem:                    %s\n", orDefault(limits.WorkMem))
+}
+
+func orDefault(value string) string {
+	if value == "" {
+		return "(server default)"
+	}
+	return value
+}
+
+// limitFlags holds the command-line flags that override database limits.
+type limitFlags struct {
+	connectionLimit          int
+	statementTimeout         string
+	idleInTransactionTimeout string
+	workMem                  string
+}
+
+// register adds the limit flags to flags, each name prefixed with prefix.
+func (f *limitFlags) register(flags *pflag.FlagSet, prefix string) {
+	flags.IntVar(&f.connectionLimit, prefix+"connection-limit", 0, "Maximum concurrent connections to the database (-1 for unlimited)")
+	flags.StringVar(&f.statementTimeout, prefix+"statement-timeout", "", "Statement timeout, e.g. 30s or 5min")
+	flags.StringVar(&f.idleInTransactionTimeout, prefix+"idle-in-transaction-timeout", "", "Idle-in-transaction session timeout, e.g. 10min")
+	flags.StringVar(&f.workMem, prefix+"work-mem", "", "work_mem for queries, e.g. 16MB")
+}
+
+// apply copies any flags that were set onto limits and reports whether any
+// were.
+func (f *limitFlags) apply(flags *pflag.FlagSet, prefix string, limits *db.Limits) bool {
+	changed := false
+	if flags.Changed(prefix + "connection-limit") {
+		limits.ConnectionLimit = f.connectionLimit
+		changed = true
+	}
+	if flags.Changed(prefix + "statement-timeout") {
+		limits.StatementTimeout = f.statementTimeout
+		changed = true
+	}
+	if flags.Changed(prefix + "idle-in-transaction-timeout") {
+		limits.IdleInTransactionTimeout = f.idleInTransactionTimeout
+		changed = true
+	}
+	if flags.Changed(prefix + "work-mem") {
+		limits.WorkMem = f.workMem
+		changed = true
+	}
+	return changed
+}
+
+func init() {
+	rootCmd.AddCommand(dbCmd)
+	dbCmd.AddCommand(dbLimitsCmd)
+	dbLimitsFlags.register(dbLimitsCmd.Flags(), "")
+}
@@ -8,13 +8,14 @@ import (
 	"github.com/t-eckert/homelab/spark/internal/config"
 	"github.com/t-eckert/homelab/spark/internal/db"
 	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
 )
 
 var deleteCmd = &cobra.Command{
 	Use:   "delete [spark-name]",
 	Short: "Delete a spark dev environment",
 	Long:  `Delete a spark dev environment and its associated database`,
-	Args:  cobra.ExactArgs(1),
+	Args:  sparkNameArg,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sparkName := args[0]
 		ctx := context.Background()
@@ -40,6 +41,12 @@ var deleteCmd = &cobra.Command{
 		}
 		fmt.Printf("Kubernetes resources deleted\n")
 
+		err = sshkeys.RemoveKnownHost(sshkeys.KnownHostsPath(), k8s.TailscaleHostname(sparkName))
+		if err != nil {
+			fmt.Printf("Warning: failed to remove host key for %s: %v\n", sparkName, err)
+		}
+		refreshSSHConfig(ctx, k8sClient)
+
 		// Delete PostgreSQL database
 		fmt.Println("Deleting PostgreSQL database...")
 		dbConnString := db.BuildConnectionString(
@@ -60,6 +67,11 @@ var deleteCmd = &cobra.Command{
 		}
 		fmt.Printf("Database deleted\n")
 
+		err = dbClient.DeleteCheckpoints(sparkName)
+		if err != nil {
+			return fmt.Errorf("failed to delete database checkpoints: %w", err)
+		}
+
 		fmt.Printf("\nSpark %s deleted successfully!\n", sparkName)
 		return nil
 	},
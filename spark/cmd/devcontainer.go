@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/t-eckert/homelab/spark/internal/devcontainer"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/templates"
+)
+
+// loadDevcontainer reads the devcontainer.json of a repository cloned into
+// workspaceFolder and prints what will be applied from it. It returns nil if
+// the repository has none; failing to read one is only a warning, as the
+// spark works without it.
+func loadDevcontainer(ctx context.Context, repo k8s.Repo, workspaceFolder string) *devcontainer.Plan {
+	fmt.Println("Checking the repository for a devcontainer.json...")
+	cfg, err := devcontainer.Fetch(ctx, repo.URL, repo.Ref)
+	if errors.Is(err, devcontainer.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		fmt.Printf("Warning: ignoring devcontainer.json: %v\n", err)
+		return nil
+	}
+
+	plan := cfg.Plan(workspaceFolder)
+	fmt.Printf("Using %s from the repository:\n", cfg.Path)
+	for _, line := range plan.Applied {
+		fmt.Printf("  ✓ %s\n", line)
+	}
+	for _, line := range plan.Ignored {
+		fmt.Printf("  ✗ %s\n", line)
+	}
+	return plan
+}
+
+// applyDevcontainer sets the spark's environment from a devcontainer.json on
+// top of its template. Variables from the local environment go in the env
+// Secret, below those given with --env.
+func applyDevcontainer(resources *k8s.SparkResources, plan *devcontainer.Plan) {
+	if plan.Image != "" {
+		resources.Image = plan.Image
+	}
+	resources.Packages = append(resources.Packages, plan.Packages...)
+	resources.Runtimes = templates.MergeMap(resources.Runtimes, plan.Runtimes)
+	resources.Env = templates.MergeMap(resources.Env, plan.Env)
+	if len(plan.LocalEnv) > 0 {
+		// Keep the values out of the Deployment and the init script
+		env := make(map[string]string, len(resources.Env))
+		for name, value := range resources.Env {
+			if _, ok := plan.LocalEnv[name]; !ok {
+				env[name] = value
+			}
+		}
+		resources.Env = env
+		resources.UserEnv = templates.MergeMap(plan.LocalEnv, resources.UserEnv)
+	}
+	resources.PostCreate = append(resources.PostCreate, plan.PostCreate...)
+	resources.PostStart = append(resources.PostStart, plan.PostStart...)
+	resources.ForwardPorts = plan.ForwardPorts
+}
+
+// checkEnvironment validates the combination of a template and a
+// devcontainer.json before anything is created from them.
+func checkEnvironment(t *templates.Template, plan *devcontainer.Plan) error {
+	resources := &k8s.SparkResources{}
+	applyTemplate(resources, t)
+	if plan != nil {
+		applyDevcontainer(resources, plan)
+	}
+	if err := resources.Validate(); err != nil {
+		return fmt.Errorf("devcontainer.json: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var (
+	createEnv     envFlags
+	envSetEnv     envFlags
+	envShowValues bool
+)
+
+var envCmd = &cobra.Command{
+	Use:   "env",
+	Short: "Manage a spark's environment variables",
+	Long: `List, set and unset the environment variables of a spark, in addition to
+DATABASE_URL, ANTHROPIC_API_KEY and SPARK_NAME, which spark sets itself.
+
+Values are kept in the spark's own Secret. Variables can also reference a
+key of an existing Secret in the spark namespace with --secret-env, so
+shared API keys needn't be copied into every spark.`,
+}
+
+var envListCmd = &cobra.Command{
+	Use:   "list [spark-name]",
+	Short: "List a spark's environment variables",
+	Args:  sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		values, refs, err := k8sClient.GetEnv(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+
+		var names []string
+		for name := range values {
+			names = append(names, name)
+		}
+		for name := range refs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Printf("Environment for %s (%d):\n\n", sparkName, len(names))
+		for _, name := range names {
+			if ref, ok := refs[name]; ok {
+				fmt.Printf("  - %s from secret %s\n", name, ref)
+			} else if envShowValues {
+				fmt.Printf("  - %s=%s\n", name, values[name])
+			} else {
+				fmt.Printf("  - %s\n", name)
+			}
+		}
+		return nil
+	},
+}
+
+var envSetCmd = &cobra.Command{
+	Use:   "set [spark-name] [KEY=VALUE]...",
+	Short: "Set environment variables on a spark",
+	Long: `Set environment variables given as arguments, read from --env-file or
+referencing existing Secrets with --secret-env.
+
+Values apply to new shells in the running spark immediately and are kept
+across restarts. Adding or removing secret references restarts the spark,
+as does the first change to a spark created before 'spark env' existed.
+
+Examples:
+  spark env set brave-dolphin STRIPE_API_KEY=sk_test_123 DEBUG=1
+  spark env set brave-dolphin --env-file .env
+  spark env set brave-dolphin --secret-env OPENAI_API_KEY=openai/api-key`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		return sparkNameArg(cmd, args[:1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		envSetEnv.values = append(envSetEnv.values, args[1:]...)
+		setValues, setRefs, err := envSetEnv.collect()
+		if err != nil {
+			return err
+		}
+		if len(setValues) == 0 && len(setRefs) == 0 {
+			return fmt.Errorf("no variables given: pass KEY=VALUE arguments, --env-file or --secret-env")
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		values, refs, err := k8sClient.GetEnv(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+		var names []string
+		for name, value := range setValues {
+			values[name] = value
+			delete(refs, name)
+			names = append(names, name)
+		}
+		for name, ref := range setRefs {
+			refs[name] = ref
+			delete(values, name)
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		if err := saveEnv(ctx, k8sClient, sparkName, values, refs); err != nil {
+			return err
+		}
+		fmt.Printf("Set %d variable(s) on %s:\n", len(names), sparkName)
+		for _, name := range names {
+			fmt.Printf("  - %s\n", name)
+		}
+		return nil
+	},
+}
+
+var envUnsetCmd = &cobra.Command{
+	Use:   "unset [spark-name] [KEY]...",
+	Short: "Remove environment variables from a spark",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(2)(cmd, args); err != nil {
+			return err
+		}
+		return sparkNameArg(cmd, args[:1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		values, refs, err := k8sClient.GetEnv(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+		for _, name := range args[1:] {
+			_, isValue := values[name]
+			_, isRef := refs[name]
+			if !isValue && !isRef {
+				return fmt.Errorf("%s is not set on %s", name, sparkName)
+			}
+			delete(values, name)
+			delete(refs, name)
+		}
+
+		if err := saveEnv(ctx, k8sClient, sparkName, values, refs); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d variable(s) from %s:\n", len(args)-1, sparkName)
+		for _, name := range args[1:] {
+			fmt.Printf("  - %s\n", name)
+		}
+		return nil
+	},
+}
+
+// envFlags holds the command-line flags setting environment variables.
+type envFlags struct {
+	values  []string
+	files   []string
+	secrets []string
+}
+
+// register adds the environment flags to flags.
+func (f *envFlags) register(flags *pflag.FlagSet) {
+	flags.StringArrayVarP(&f.values, "env", "e", nil, "Set an environment variable, KEY=VALUE (repeatable)")
+	flags.StringArrayVar(&f.files, "env-file", nil, "Set the environment variables in a .env file (repeatable)")
+	flags.StringArrayVar(&f.secrets, "secret-env", nil, "Set an environment variable from an existing Secret, KEY=secretName/key (repeatable)")
+}
+
+// collect reads the env files and parses the variables. Variables given
+// with --env win over those in files.
+func (f *envFlags) collect() (map[string]string, map[string]k8s.SecretRef, error) {
+	values := make(map[string]string)
+	for _, path := range f.files {
+		fileValues, err := parseEnvFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+	for _, arg := range f.values {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid variable %q, expected KEY=VALUE", arg)
+		}
+		values[name] = value
+	}
+
+	refs := make(map[string]k8s.SecretRef)
+	for _, arg := range f.secrets {
+		name, secret, ok := strings.Cut(arg, "=")
+		if !ok {
+			return nil, nil, fmt.Errorf("invalid secret variable %q, expected KEY=secretName/key", arg)
+		}
+		ref, err := k8s.ParseSecretRef(secret)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := values[name]; ok {
+			return nil, nil, fmt.Errorf("%s is given both a value and a secret reference", name)
+		}
+		refs[name] = ref
+	}
+
+	for name := range values {
+		if err := k8s.ValidateEnvName(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	for name := range refs {
+		if err := k8s.ValidateEnvName(name); err != nil {
+			return nil, nil, err
+		}
+	}
+	return values, refs, nil
+}
+
+// parseEnvFile reads the KEY=VALUE lines of a .env file. Blank lines and
+// comments are skipped, lines may start with "export" and values may be
+// single or double quoted.
+func parseEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		name, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNumber)
+		}
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+
+		switch {
+		case strings.HasPrefix(value, `"`):
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value for %s", path, lineNumber, name)
+			}
+			value = unquoted
+		case strings.HasPrefix(value, "'"):
+			if len(value) < 2 || !strings.HasSuffix(value, "'") {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value for %s", path, lineNumber, name)
+			}
+			value = value[1 : len(value)-1]
+		default:
+			if i := strings.Index(value, " #"); i >= 0 {
+				value = strings.TrimSpace(value[:i])
+			}
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	return values, nil
+}
+
+func saveEnv(ctx context.Context, k8sClient *k8s.Client, sparkName string, values map[string]string, refs map[string]k8s.SecretRef) error {
+	applied, err := k8sClient.SetEnv(ctx, sparkName, values, refs)
+	if err != nil {
+		return err
+	}
+	switch applied {
+	case k8s.EnvRestarting:
+		fmt.Printf("%s is restarting to apply its environment\n", sparkName)
+	case k8s.EnvPending:
+		fmt.Printf("%s has no running pod; the variables apply when it starts\n", sparkName)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(envCmd)
+	envCmd.AddCommand(envListCmd)
+	envCmd.AddCommand(envSetCmd)
+	envCmd.AddCommand(envUnsetCmd)
+	envListCmd.Flags().BoolVar(&envShowValues, "show-values", false, "Show the variables' values")
+	envSetEnv.register(envSetCmd.Flags())
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/terminal"
+	"golang.org/x/term"
+	"k8s.io/client-go/tools/remotecommand"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+// loginShellScript starts a login shell as the user given as its argument,
+// keeping the variables SSH sessions get. su -l resets the environment, and
+// busybox su can't keep variables like util-linux su -w, so they are
+// exported, quoted, in the command su runs.
+const loginShellScript = `cmd=
+for name in TERM DATABASE_URL ANTHROPIC_API_KEY SPARK_NAME; do
+    value=$(printenv "$name") || continue
+    cmd="$cmd export $name='$(printf '%s' "$value" | sed "s/'/'\\\\''/g")';"
+done
+exec su -l "$1" -c "$cmd"' exec "$SHELL" -l'`
+
+// execShell opens an interactive login shell as the spark user through the
+// Kubernetes exec API, for when the spark is not reachable over the tailnet.
+func execShell(ctx context.Context, k8sClient *k8s.Client, sparkName string) error {
+	termType := os.Getenv("TERM")
+	if termType == "" {
+		termType = "xterm-256color"
+	}
+
+	opts := k8s.ExecOptions{
+		Command: []string{
+			"env", "TERM=" + termType,
+			"sh", "-c", loginShellScript, "spark-shell", sparkUser,
+		},
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+
+		queue := newSizeQueue()
+		if width, height, err := term.GetSize(fd); err == nil {
+			queue.push(width, height)
+		}
+		stop := terminal.WatchResize(fd, queue.push)
+		defer stop()
+		defer queue.close()
+
+		opts.TTY = true
+		opts.SizeQueue = queue
+	}
+
+	err := k8sClient.Exec(ctx, sparkName, opts)
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		// The shell exiting with the status of its last command is not a
+		// connection failure
+		return nil
+	}
+	return err
+}
+
+// sizeQueue feeds local terminal size changes to the exec API, keeping only
+// the latest size if they arrive faster than they are sent.
+type sizeQueue struct {
+	sizes chan remotecommand.TerminalSize
+	done  chan struct{}
+}
+
+func newSizeQueue() *sizeQueue {
+	return &sizeQueue{
+		sizes: make(chan remotecommand.TerminalSize, 1),
+		done:  make(chan struct{}),
+	}
+}
+
+func (q *sizeQueue) push(width, height int) {
+	size := remotecommand.TerminalSize{Width: uint16(width), Height: uint16(height)}
+	select {
+	case <-q.sizes:
+	default:
+	}
+	select {
+	case q.sizes <- size:
+	default:
+	}
+}
+
+// Next implements remotecommand.TerminalSizeQueue.
+func (q *sizeQueue) Next() *remotecommand.TerminalSize {
+	select {
+	case size := <-q.sizes:
+		return &size
+	case <-q.done:
+		return nil
+	}
+}
+
+func (q *sizeQueue) close() {
+	close(q.done)
+}
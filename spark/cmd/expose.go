@@ -0,0 +1,208 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+var (
+	exposeFunnel   bool
+	exposeIngress  bool
+	exposeHostname string
+	exposeAuth     string
+)
+
+// hostnamePattern is a DNS label, as required for tailnet device names.
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var exposeCmd = &cobra.Command{
+	Use:   "expose [spark-name] [port]",
+	Short: "Expose a spark port on the tailnet or publicly",
+	Long: `Expose a port of a spark as its own tailnet device, so web apps running
+inside it can be shared. The device is named spark-<name>-<port> unless
+--hostname is given.
+
+With --funnel the port is published to the internet over HTTPS through
+Tailscale Funnel, which must be enabled for the tailnet.
+
+With --ingress the port is routed through the cluster's Traefik at
+<name>.<domain> (or <hostname>.<domain>), giving it a stable URL for webhooks
+and OAuth callbacks. --auth protects it with HTTP basic auth; a password is
+generated if none is given.
+
+Examples:
+  spark expose brave-dolphin 3000
+  spark expose brave-dolphin 3000 --funnel --hostname dolphin-demo
+  spark expose brave-dolphin 3000 --ingress --auth demo`,
+	Args: exposeArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		port, _ := parsePort(args[1])
+		ctx := context.Background()
+
+		if exposeFunnel && exposeIngress {
+			return fmt.Errorf("--funnel and --ingress cannot be used together")
+		}
+		if exposeAuth != "" && !exposeIngress {
+			return fmt.Errorf("--auth requires --ingress")
+		}
+
+		opts := k8s.ExposeOptions{Hostname: exposeHostname, Funnel: exposeFunnel, Ingress: exposeIngress}
+		if opts.Hostname == "" {
+			opts.Hostname = k8s.ExposeHostname(sparkName, port)
+			if exposeIngress {
+				opts.Hostname = sparkName
+			}
+		}
+		if !hostnamePattern.MatchString(opts.Hostname) {
+			return fmt.Errorf("invalid hostname %q: must be a lowercase DNS label", opts.Hostname)
+		}
+
+		if exposeIngress {
+			cfg, err := config.Load()
+			if err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+			opts.Hostname += "." + cfg.IngressDomain
+			opts.EntryPoint = cfg.IngressEntryPoint
+
+			if exposeAuth != "" {
+				opts.BasicAuth, err = parseBasicAuth(exposeAuth)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		err = k8sClient.Expose(ctx, sparkName, port, opts)
+		if err != nil {
+			return fmt.Errorf("failed to expose port %d: %w", port, err)
+		}
+
+		switch {
+		case exposeIngress:
+			fmt.Printf("Exposing %s port %d at %s\n", sparkName, port, k8s.IngressURL(opts.Hostname, opts.EntryPoint))
+			if opts.BasicAuth != nil {
+				fmt.Printf("Basic auth: %s / %s\n", opts.BasicAuth.Username, opts.BasicAuth.Password)
+			}
+			return nil
+		case exposeFunnel:
+			fmt.Printf("Exposing %s port %d publicly as %s through Tailscale Funnel\n", sparkName, port, opts.Hostname)
+		default:
+			fmt.Printf("Exposing %s port %d on the tailnet as %s\n", sparkName, port, opts.Hostname)
+		}
+		fmt.Printf("The URL appears in 'spark status %s' once Tailscale has provisioned the device.\n", sparkName)
+		return nil
+	},
+}
+
+var unexposeCmd = &cobra.Command{
+	Use:   "unexpose [spark-name] [port]",
+	Short: "Stop exposing a spark port",
+	Args:  exposeArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		port, _ := parsePort(args[1])
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		err = k8sClient.Unexpose(ctx, sparkName, port)
+		if apierrors.IsNotFound(err) {
+			return fmt.Errorf("port %d of %s is not exposed", port, sparkName)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to unexpose port %d: %w", port, err)
+		}
+
+		fmt.Printf("Port %d of %s is no longer exposed\n", port, sparkName)
+		return nil
+	},
+}
+
+// exposeArgs requires a spark name and a port.
+func exposeArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.ExactArgs(2)(cmd, args); err != nil {
+		return err
+	}
+	if err := names.Validate(args[0]); err != nil {
+		return err
+	}
+	_, err := parsePort(args[1])
+	return err
+}
+
+func parsePort(s string) (int32, error) {
+	port, err := strconv.Atoi(s)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q: ports must be between 1 and 65535", s)
+	}
+	return int32(port), nil
+}
+
+// parseBasicAuth parses a "user" or "user:password" credential, generating a
+// password when none is given.
+func parseBasicAuth(value string) (*k8s.BasicAuth, error) {
+	username, password, _ := strings.Cut(value, ":")
+	if username == "" {
+		return nil, fmt.Errorf("invalid --auth %q: expected user or user:password", value)
+	}
+
+	if password == "" {
+		buf := make([]byte, 18)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate password: %w", err)
+		}
+		password = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	return &k8s.BasicAuth{Username: username, Password: password}, nil
+}
+
+// printExposures prints a spark's exposed ports, indented for list output.
+func printExposures(exposures []k8s.Exposure) {
+	for _, exposure := range exposures {
+		url := exposure.URL
+		if url == "" {
+			url = "(pending)"
+		}
+		visibility := "tailnet"
+		switch {
+		case exposure.Ingress && exposure.BasicAuth:
+			visibility = "ingress, basic auth"
+		case exposure.Ingress:
+			visibility = "ingress"
+		case exposure.Funnel:
+			visibility = "public"
+		}
+		fmt.Printf("    Port %d: %s (%s)\n", exposure.Port, url, visibility)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(exposeCmd)
+	rootCmd.AddCommand(unexposeCmd)
+	exposeCmd.Flags().BoolVar(&exposeFunnel, "funnel", false, "Publish the port to the internet through Tailscale Funnel")
+	exposeCmd.Flags().BoolVar(&exposeIngress, "ingress", false, "Route <name>.<domain> to the port through Traefik")
+	exposeCmd.Flags().StringVar(&exposeHostname, "hostname", "", "Hostname for the port (default spark-<name>-<port>, or <name> with --ingress)")
+	exposeCmd.Flags().StringVar(&exposeAuth, "auth", "", "Require basic auth as user[:password] for an --ingress port")
+}
@@ -0,0 +1,327 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+)
+
+// forwardRetryInterval is how long to wait before reconnecting a lost port
+// forward, for example while the spark's pod restarts.
+const forwardRetryInterval = 2 * time.Second
+
+var (
+	forwardBackground bool
+	forwardDaemonized bool
+	forwardStopAll    bool
+)
+
+// forwardState records a background port forward so it can be listed and
+// stopped.
+type forwardState struct {
+	ID      string    `json:"id"`
+	Spark   string    `json:"spark"`
+	Ports   []string  `json:"ports"`
+	PID     int       `json:"pid"`
+	LogFile string    `json:"logFile"`
+	Started time.Time `json:"started"`
+}
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward [spark-name] [port|local:remote]...",
+	Short: "Forward local ports to a spark",
+	Long: `Forward local ports to a spark through the Kubernetes API, so web apps
+started inside it can be opened from this machine. The forward reconnects
+automatically when the spark's pod restarts.
+
+Without ports, the forwardPorts of the devcontainer.json the spark was
+created from are forwarded.
+
+With --background the forward keeps running in a background process; use
+'spark forward list' and 'spark forward stop' to manage it.
+
+Examples:
+  spark forward brave-dolphin 3000             # localhost:3000 -> spark:3000
+  spark forward brave-dolphin 3000 8080:80     # and localhost:8080 -> spark:80
+  spark forward brave-dolphin 3000 --background
+  spark forward brave-dolphin                  # the devcontainer.json forwardPorts`,
+	Args: forwardArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName, ports := args[0], args[1:]
+
+		if len(ports) == 0 {
+			k8sClient, err := k8s.NewClient()
+			if err != nil {
+				return fmt.Errorf("failed to create k8s client: %w", err)
+			}
+			ports, err = k8sClient.GetForwardPorts(context.Background(), sparkName)
+			if err != nil {
+				return err
+			}
+			if len(ports) == 0 {
+				return fmt.Errorf("no ports given and %s has no devcontainer.json forwardPorts", sparkName)
+			}
+		}
+
+		if forwardBackground {
+			return startBackgroundForward(sparkName, ports)
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		if forwardDaemonized {
+			defer os.Remove(forwardStatePath(forwardID(sparkName, os.Getpid())))
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		for {
+			err := k8sClient.PortForward(ctx, sparkName, ports, os.Stdout, os.Stderr)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				fmt.Printf("Port forward to %s lost (%v), reconnecting...\n", sparkName, err)
+			} else {
+				fmt.Printf("Port forward to %s closed, reconnecting...\n", sparkName)
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(forwardRetryInterval):
+			}
+		}
+	},
+}
+
+var forwardListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List background port forwards",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		states, err := loadForwardStates()
+		if err != nil {
+			return err
+		}
+
+		if len(states) == 0 {
+			fmt.Println("No background port forwards")
+			return nil
+		}
+
+		fmt.Printf("Background port forwards (%d):\n\n", len(states))
+		for _, state := range states {
+			fmt.Printf("  - %s\n", state.ID)
+			fmt.Printf("    Spark: %s\n", state.Spark)
+			fmt.Printf("    Ports: %s\n", strings.Join(state.Ports, " "))
+			fmt.Printf("    Since: %s\n", state.Started.Local().Format("2006-01-02 15:04:05"))
+			fmt.Printf("    Log:   %s\n", state.LogFile)
+			fmt.Println()
+		}
+
+		return nil
+	},
+}
+
+var forwardStopCmd = &cobra.Command{
+	Use:   "stop [spark-name|forward-id]...",
+	Short: "Stop background port forwards",
+	Long: `Stop background port forwards by spark name or by the ID shown in
+'spark forward list'. Use --all to stop every background forward.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 && !forwardStopAll {
+			return fmt.Errorf("specify a spark name or forward ID, or use --all")
+		}
+
+		states, err := loadForwardStates()
+		if err != nil {
+			return err
+		}
+
+		stopped := 0
+		for _, state := range states {
+			if !forwardStopAll && !matchesAny(state, args) {
+				continue
+			}
+			if err := stopProcess(state.PID); err != nil {
+				fmt.Printf("  ✗ %s: %v\n", state.ID, err)
+				continue
+			}
+			_ = os.Remove(forwardStatePath(state.ID))
+			fmt.Printf("  ✓ stopped %s\n", state.ID)
+			stopped++
+		}
+
+		if stopped == 0 {
+			fmt.Println("No matching background port forwards")
+		}
+		return nil
+	},
+}
+
+// forwardArgs requires a spark name followed by valid ports.
+func forwardArgs(cmd *cobra.Command, args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("requires a spark name")
+	}
+	if err := names.Validate(args[0]); err != nil {
+		return err
+	}
+	for _, port := range args[1:] {
+		if err := validatePortMapping(port); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validatePortMapping checks a "port" or "local:remote" mapping.
+func validatePortMapping(mapping string) error {
+	parts := strings.Split(mapping, ":")
+	if len(parts) > 2 {
+		return fmt.Errorf("invalid port %q: expected port or local:remote", mapping)
+	}
+	for i, part := range parts {
+		// An empty local port lets the system pick one, as with kubectl
+		if part == "" && i == 0 && len(parts) == 2 {
+			continue
+		}
+		port, err := strconv.Atoi(part)
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %q: ports must be between 1 and 65535", mapping)
+		}
+	}
+	return nil
+}
+
+// startBackgroundForward re-runs this forward in a detached process that
+// logs to a file, and records it for 'spark forward list'.
+func startBackgroundForward(sparkName string, ports []string) error {
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find spark executable: %w", err)
+	}
+
+	dir := forwardStateDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	logFile, err := os.CreateTemp(dir, sparkName+"-*.log")
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %w", err)
+	}
+	defer logFile.Close()
+
+	args := append([]string{"forward", "--daemonized", sparkName}, ports...)
+	daemon := exec.Command(executable, args...)
+	daemon.Stdout = logFile
+	daemon.Stderr = logFile
+	daemon.SysProcAttr = detachedProcAttr()
+	if err := daemon.Start(); err != nil {
+		return fmt.Errorf("failed to start background forward: %w", err)
+	}
+
+	state := forwardState{
+		ID:      forwardID(sparkName, daemon.Process.Pid),
+		Spark:   sparkName,
+		Ports:   ports,
+		PID:     daemon.Process.Pid,
+		LogFile: logFile.Name(),
+		Started: time.Now(),
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(forwardStatePath(state.ID), data, 0o600); err != nil {
+		_ = stopProcess(state.PID)
+		return fmt.Errorf("failed to record background forward: %w", err)
+	}
+
+	// Let the daemon go on without us waiting for it
+	_ = daemon.Process.Release()
+
+	fmt.Printf("Forwarding %s to %s in the background (%s)\n", strings.Join(ports, " "), sparkName, state.ID)
+	fmt.Printf("Logs: %s\n", state.LogFile)
+	fmt.Printf("Stop with: spark forward stop %s\n", state.ID)
+	return nil
+}
+
+// loadForwardStates returns the recorded background forwards whose process
+// is still running, removing records of ones that have exited.
+func loadForwardStates() ([]forwardState, error) {
+	paths, err := filepath.Glob(filepath.Join(forwardStateDir(), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var states []forwardState
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var state forwardState
+		if err := json.Unmarshal(data, &state); err != nil {
+			continue
+		}
+		if !processAlive(state.PID) {
+			_ = os.Remove(path)
+			continue
+		}
+		states = append(states, state)
+	}
+
+	return states, nil
+}
+
+func matchesAny(state forwardState, args []string) bool {
+	for _, arg := range args {
+		if arg == state.ID || arg == state.Spark {
+			return true
+		}
+	}
+	return false
+}
+
+func forwardID(sparkName string, pid int) string {
+	return fmt.Sprintf("%s-%d", sparkName, pid)
+}
+
+func forwardStateDir() string {
+	return filepath.Join(config.Dir(), "forwards")
+}
+
+func forwardStatePath(id string) string {
+	return filepath.Join(forwardStateDir(), id+".json")
+}
+
+func init() {
+	rootCmd.AddCommand(forwardCmd)
+	forwardCmd.AddCommand(forwardListCmd)
+	forwardCmd.AddCommand(forwardStopCmd)
+
+	forwardCmd.Flags().BoolVar(&forwardBackground, "background", false, "Keep the forward running in a background process")
+	forwardCmd.Flags().BoolVar(&forwardDaemonized, "daemonized", false, "Run as a background forward process")
+	_ = forwardCmd.Flags().MarkHidden("daemonized")
+	forwardStopCmd.Flags().BoolVar(&forwardStopAll, "all", false, "Stop every background port forward")
+}
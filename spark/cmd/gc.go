@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/db"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var (
+	gcDryRun bool
+	gcYes    bool
+)
+
+var gcCmd = &cobra.Command{
+	Use:   "gc",
+	Short: "Find and clean up orphaned spark resources",
+	Long: `Find databases (including checkpoints) owned by the spark PostgreSQL user
+and Kubernetes objects labeled app=spark that no longer belong to a spark
+with a Deployment, and offer to delete them. Only databases named like a
+spark or checkpoint database are considered; others are never touched.
+
+Orphans are left behind by failed creates and partial deletes. Avoid running
+gc while a spark is being created, as its database and objects exist before
+its Deployment does.
+
+Examples:
+  spark gc --dry-run   # Only report orphans
+  spark gc             # Report orphans and ask before deleting
+  spark gc --yes       # Delete orphans without asking`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		cfg, err := config.Load()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		dbClient, err := newDBClient(cfg)
+		if err != nil {
+			return err
+		}
+		defer dbClient.Close()
+
+		sparks, err := k8sClient.ListSparks(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list sparks: %w", err)
+		}
+		active := make(map[string]bool, len(sparks))
+		for _, name := range sparks {
+			active[name] = true
+		}
+
+		databases, err := dbClient.ListOwnedDatabases()
+		if err != nil {
+			return err
+		}
+		var orphanDatabases []string
+		for _, database := range databases {
+			if database == cfg.PostgresDB || !db.IsSparkDatabase(database) || active[db.SparkNameForDatabase(database)] {
+				continue
+			}
+			orphanDatabases = append(orphanDatabases, database)
+		}
+
+		orphanObjects, err := k8sClient.ListOrphanedObjects(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list orphaned objects: %w", err)
+		}
+
+		if len(orphanDatabases) == 0 && len(orphanObjects) == 0 {
+			fmt.Println("No orphaned resources found")
+			return nil
+		}
+
+		if len(orphanDatabases) > 0 {
+			fmt.Printf("Orphaned databases (%d):\n", len(orphanDatabases))
+			for _, database := range orphanDatabases {
+				fmt.Printf("  - %s\n", database)
+			}
+			fmt.Println()
+		}
+		if len(orphanObjects) > 0 {
+			fmt.Printf("Orphaned Kubernetes objects (%d):\n", len(orphanObjects))
+			for _, obj := range orphanObjects {
+				fmt.Printf("  - %s/%s (spark %s)\n", obj.Kind, obj.Name, obj.SparkName)
+			}
+			fmt.Println()
+		}
+
+		if gcDryRun {
+			fmt.Println("Dry run, nothing deleted")
+			return nil
+		}
+
+		if !gcYes && !confirm("Delete these resources?") {
+			fmt.Println("Aborted, nothing deleted")
+			return nil
+		}
+
+		var failed int
+		for _, database := range orphanDatabases {
+			if err := dbClient.DeleteDatabase(database); err != nil {
+				fmt.Printf("  ✗ database %s: %v\n", database, err)
+				failed++
+				continue
+			}
+			fmt.Printf("  ✓ database %s\n", database)
+		}
+		for _, obj := range orphanObjects {
+			if err := k8sClient.DeleteObject(ctx, obj); err != nil {
+				fmt.Printf("  ✗ %s/%s: %v\n", obj.Kind, obj.Name, err)
+				failed++
+				continue
+			}
+			fmt.Printf("  ✓ %s/%s\n", obj.Kind, obj.Name)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("failed to delete %d orphaned resources", failed)
+		}
+		fmt.Println("\nOrphaned resources deleted")
+		return nil
+	},
+}
+
+// confirm asks a yes/no question on stdin and reports whether the answer was
+// yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+func init() {
+	rootCmd.AddCommand(gcCmd)
+	gcCmd.Flags().BoolVar(&gcDryRun, "dry-run", false, "Only report orphaned resources")
+	gcCmd.Flags().BoolVarP(&gcYes, "yes", "y", false, "Delete orphaned resources without asking")
+}
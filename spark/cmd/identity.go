@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var createIdentity identityFlags
+
+// identityFlags holds the command-line flags overriding the identity from
+// the configuration file.
+type identityFlags struct {
+	dotfiles        string
+	dotfilesInstall string
+	noDotfiles      bool
+	gitName         string
+	gitEmail        string
+	githubUser      string
+	shell           string
+}
+
+// register adds the identity flags to flags.
+func (f *identityFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&f.dotfiles, "dotfiles", "", "Dotfiles repository to install, a URL or GitHub owner/repo")
+	flags.StringVar(&f.dotfilesInstall, "dotfiles-install", "", "Command installing the dotfiles, run in their clone (default: the first of install.sh, bootstrap.sh, setup.sh and similar)")
+	flags.BoolVar(&f.noDotfiles, "no-dotfiles", false, "Don't install dotfiles")
+	flags.StringVar(&f.gitName, "git-name", "", "Git author name (default: git config user.name)")
+	flags.StringVar(&f.gitEmail, "git-email", "", "Git author email (default: git config user.email)")
+	flags.StringVar(&f.githubUser, "github-user", "", "GitHub user GITHUB_TOKEN belongs to (default: git config github.user)")
+	flags.StringVar(&f.shell, "shell", "", "Login shell, "+strings.Join(k8s.Shells, " or ")+" (default: bash)")
+}
+
+// resolve returns the identity from the configuration file with the flags
+// given applied, checking that a spark can be created with it.
+func (f *identityFlags) resolve(identity config.Identity) (config.Identity, error) {
+	for value, flag := range map[*string]string{
+		&identity.Dotfiles.Repo:    f.dotfiles,
+		&identity.Dotfiles.Install: f.dotfilesInstall,
+		&identity.Git.Name:         f.gitName,
+		&identity.Git.Email:        f.gitEmail,
+		&identity.GitHub.User:      f.githubUser,
+		&identity.Shell:            f.shell,
+	} {
+		if flag != "" {
+			*value = flag
+		}
+	}
+	if f.noDotfiles {
+		identity.Dotfiles.Repo = ""
+	}
+
+	resources := &k8s.SparkResources{}
+	applyIdentity(resources, identity)
+	if err := resources.Validate(); err != nil {
+		return identity, err
+	}
+	return identity, nil
+}
+
+// applyIdentity sets the spark user's identity.
+func applyIdentity(resources *k8s.SparkResources, identity config.Identity) {
+	resources.DotfilesRepo = dotfilesURL(identity.Dotfiles.Repo)
+	resources.DotfilesInstall = identity.Dotfiles.Install
+	resources.GitName = identity.Git.Name
+	resources.GitEmail = identity.Git.Email
+	resources.GitHubUser = identity.GitHub.User
+	resources.Shell = identity.Shell
+}
+
+// dotfilesURL expands a GitHub owner/repo to its clone URL, returning
+// anything else as is.
+func dotfilesURL(repo string) string {
+	if strings.Count(repo, "/") == 1 && !strings.Contains(repo, ":") {
+		return "https://github.com/" + strings.TrimSuffix(repo, ".git") + ".git"
+	}
+	return repo
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
+)
+
+var (
+	createKeys  keyFlags
+	keysAddKeys keyFlags
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the SSH keys authorized to log into a spark",
+	Long: `List, add and remove the public keys allowed to log into a spark as user.
+Changes apply to the running spark immediately and are kept across
+restarts.`,
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list [spark-name]",
+	Short: "List a spark's authorized keys",
+	Args:  sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		keys, err := loadAuthorizedKeys(ctx, k8sClient, sparkName)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Authorized keys for %s (%d):\n\n", sparkName, len(keys))
+		for _, key := range keys {
+			printAuthorizedKey(key)
+		}
+		return nil
+	},
+}
+
+var keysAddCmd = &cobra.Command{
+	Use:   "add [spark-name] [public-key]...",
+	Short: "Authorize more keys to log into a spark",
+	Long: `Authorize public keys given as arguments, read from --key-file or fetched
+from GitHub with --github-keys.
+
+Examples:
+  spark keys add brave-dolphin --github-keys octocat
+  spark keys add brave-dolphin --key-file ~/teammate.pub
+  spark keys add brave-dolphin "ssh-ed25519 AAAA... alice@laptop"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(1)(cmd, args); err != nil {
+			return err
+		}
+		return sparkNameArg(cmd, args[:1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		added, err := keysAddKeys.collect(ctx)
+		if err != nil {
+			return err
+		}
+		for _, line := range args[1:] {
+			key, err := sshkeys.ParseAuthorizedKey(line)
+			if err != nil {
+				return err
+			}
+			added = append(added, key)
+		}
+		if len(added) == 0 {
+			return fmt.Errorf("no keys given: pass keys as arguments, --key-file or --github-keys")
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		keys, err := loadAuthorizedKeys(ctx, k8sClient, sparkName)
+		if err != nil {
+			return err
+		}
+		merged := sshkeys.MergeAuthorizedKeys(keys, added...)
+		if len(merged) == len(keys) {
+			fmt.Println("All keys are already authorized")
+			return nil
+		}
+
+		if err := saveAuthorizedKeys(ctx, k8sClient, sparkName, merged); err != nil {
+			return err
+		}
+		fmt.Printf("Authorized %d key(s) for %s:\n", len(merged)-len(keys), sparkName)
+		for _, key := range merged[len(keys):] {
+			printAuthorizedKey(key)
+		}
+		return nil
+	},
+}
+
+var keysRemoveCmd = &cobra.Command{
+	Use:   "remove [spark-name] [fingerprint|comment|public-key]...",
+	Short: "Stop authorizing keys to log into a spark",
+	Long: `Remove authorized keys by fingerprint (as shown by 'spark keys list'),
+comment or the whole key. Keys fetched with --github-keys have the comment
+github:<user>, so all of a GitHub user's keys can be removed at once.
+
+Examples:
+  spark keys remove brave-dolphin github:octocat
+  spark keys remove brave-dolphin SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if err := cobra.MinimumNArgs(2)(cmd, args); err != nil {
+			return err
+		}
+		return sparkNameArg(cmd, args[:1])
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		keys, err := loadAuthorizedKeys(ctx, k8sClient, sparkName)
+		if err != nil {
+			return err
+		}
+
+		var removed []sshkeys.AuthorizedKey
+		for _, match := range args[1:] {
+			var r []sshkeys.AuthorizedKey
+			keys, r = sshkeys.RemoveAuthorizedKeys(keys, match)
+			if len(r) == 0 {
+				return fmt.Errorf("no authorized key matches %q", match)
+			}
+			removed = append(removed, r...)
+		}
+		if len(keys) == 0 {
+			return fmt.Errorf("refusing to remove every authorized key, which would lock everyone out of %s", sparkName)
+		}
+
+		if err := saveAuthorizedKeys(ctx, k8sClient, sparkName, keys); err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d key(s) from %s:\n", len(removed), sparkName)
+		for _, key := range removed {
+			printAuthorizedKey(key)
+		}
+		return nil
+	},
+}
+
+// keyFlags holds the command-line flags adding authorized keys.
+type keyFlags struct {
+	files       []string
+	githubUsers []string
+}
+
+// register adds the key flags to flags.
+func (f *keyFlags) register(flags *pflag.FlagSet) {
+	flags.StringArrayVar(&f.files, "key-file", nil, "Authorize the public keys in a file (repeatable)")
+	flags.StringArrayVar(&f.githubUsers, "github-keys", nil, "Authorize a GitHub user's public keys (repeatable)")
+}
+
+// collect reads the key files and fetches the GitHub users' keys.
+func (f *keyFlags) collect(ctx context.Context) ([]sshkeys.AuthorizedKey, error) {
+	var keys []sshkeys.AuthorizedKey
+	for _, path := range f.files {
+		fileKeys, err := sshkeys.ReadAuthorizedKeysFile(path)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, fileKeys...)
+	}
+	for _, user := range f.githubUsers {
+		githubKeys, err := sshkeys.FetchGitHubKeys(ctx, user)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, githubKeys...)
+	}
+	return keys, nil
+}
+
+func loadAuthorizedKeys(ctx context.Context, k8sClient *k8s.Client, sparkName string) ([]sshkeys.AuthorizedKey, error) {
+	data, err := k8sClient.GetAuthorizedKeys(ctx, sparkName)
+	if err != nil {
+		return nil, fmt.Errorf("spark %s not found: %w", sparkName, err)
+	}
+	return sshkeys.ParseAuthorizedKeys(data)
+}
+
+func saveAuthorizedKeys(ctx context.Context, k8sClient *k8s.Client, sparkName string, keys []sshkeys.AuthorizedKey) error {
+	live, err := k8sClient.SetAuthorizedKeys(ctx, sparkName, sshkeys.FormatAuthorizedKeys(keys))
+	if err != nil {
+		return err
+	}
+	if !live {
+		fmt.Printf("%s has no running pod; the keys apply when it starts\n", sparkName)
+	}
+	return nil
+}
+
+func printAuthorizedKey(key sshkeys.AuthorizedKey) {
+	comment := key.Comment
+	if comment == "" {
+		comment = "(no comment)"
+	}
+	fmt.Printf("  - %s %s %s\n", key.Fingerprint, key.Type, comment)
+}
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysAddCmd)
+	keysCmd.AddCommand(keysRemoveCmd)
+	keysAddKeys.register(keysAddCmd.Flags())
+}
@@ -49,6 +49,9 @@ var listCmd = &cobra.Command{
 			fmt.Printf("  - %s (%s)\n", sparkName, status)
 			fmt.Printf("    SSH: ssh user@spark-%s\n", sparkName)
 			fmt.Printf("    Database: %s\n", sparkName)
+			if exposures, err := k8sClient.ListExposures(ctx, sparkName); err == nil && len(exposures) > 0 {
+				printExposures(exposures)
+			}
 			fmt.Println()
 		}
 
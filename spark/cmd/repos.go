@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var createRepos repoFlags
+
+// repoFlags holds the command-line flags choosing the repositories cloned
+// into a spark.
+type repoFlags struct {
+	specs        []string
+	ref          string
+	path         string
+	depth        int
+	noSubmodules bool
+}
+
+// register adds the repository flags to flags.
+func (f *repoFlags) register(flags *pflag.FlagSet) {
+	flags.StringArrayVarP(&f.specs, "repo", "r", nil, "Git repository to clone into the spark, url[@ref][:path] (repeatable)")
+	flags.StringVar(&f.ref, "ref", "", "Branch, tag or commit of --repo to check out")
+	flags.StringVar(&f.path, "path", "", "Directory to clone --repo into, relative to /home/user (default: project)")
+	flags.IntVar(&f.depth, "depth", 0, "Clone only the last n commits of each repository and its submodules (default: full history)")
+	flags.BoolVar(&f.noSubmodules, "no-submodules", false, "Don't clone the repositories' submodules")
+}
+
+// resolve parses the repositories, checking that a spark can be created
+// with them.
+func (f *repoFlags) resolve() ([]k8s.Repo, error) {
+	if (f.ref != "" || f.path != "") && len(f.specs) != 1 {
+		return nil, fmt.Errorf("--ref and --path apply to a single --repo; give each repository as url[@ref][:path] instead")
+	}
+
+	var repos []k8s.Repo
+	for _, spec := range f.specs {
+		repo, err := k8s.ParseRepo(spec)
+		if err != nil {
+			return nil, err
+		}
+		if f.ref != "" {
+			if repo.Ref != "" {
+				return nil, fmt.Errorf("%s already has a ref, drop --ref", spec)
+			}
+			repo.Ref = f.ref
+		}
+		if f.path != "" {
+			if repo.Path != "" {
+				return nil, fmt.Errorf("%s already has a path, drop --path", spec)
+			}
+			repo.Path = f.path
+		}
+		repos = append(repos, repo)
+	}
+
+	resources := &k8s.SparkResources{}
+	f.apply(resources, repos)
+	if err := resources.Validate(); err != nil {
+		return nil, err
+	}
+	return repos, nil
+}
+
+// apply sets the repositories cloned into the spark and how.
+func (f *repoFlags) apply(resources *k8s.SparkResources, repos []k8s.Repo) {
+	resources.Repos = repos
+	resources.CloneDepth = f.depth
+	resources.Submodules = !f.noSubmodules
+}
@@ -18,20 +18,41 @@ Each spark gets:
   - Tailscale connectivity for external access
   - Dedicated PostgreSQL database
   - Pre-configured environment variables (DATABASE_URL, ANTHROPIC_API_KEY)
+    and your own, set with --env or from existing Secrets
   - Optional git repository cloning
 
 Commands:
-  create - Create a new spark
-  list   - List all active sparks
-  shell  - SSH into an existing spark
-  delete - Destroy a spark and its database
+  create     - Create a new spark
+  list       - List all active sparks
+  status     - Show the details of a spark
+  resize     - Change a spark's CPU and memory limits
+  shell      - Open a shell in an existing spark
+  delete     - Destroy a spark and its database
+  db         - Manage a spark's database
+  gc         - Clean up orphaned databases and Kubernetes objects
+  cp         - Copy files and directories to and from a spark
+  sync       - Continuously sync a local directory with a spark
+  forward    - Forward local ports to a spark
+  expose     - Expose a spark port on the tailnet or publicly
+  ssh-config - Generate ~/.ssh/config entries for sparks
+  code       - Open a spark in a local editor
+  keys       - Manage the SSH keys authorized to log into a spark
+  env        - Manage a spark's environment variables
+  templates  - List and show spark templates
 
 Examples:
   spark create                     # Create a new spark
   spark create --repo https://...  # Create with git repo
+  spark create --template go-api   # Create from a template
   spark list                       # List all sparks
   spark shell brave-dolphin        # SSH into a spark
-  spark delete brave-dolphin       # Delete a spark`,
+  spark delete brave-dolphin       # Delete a spark
+  spark db limits brave-dolphin    # Show database limits
+  spark db checkpoint brave-dolphin before-migration
+                                   # Save a copy of the database
+  spark gc --dry-run               # Find orphaned resources
+  spark forward brave-dolphin 3000 # Forward localhost:3000 to a spark
+  spark expose brave-dolphin 3000  # Share port 3000 on the tailnet`,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
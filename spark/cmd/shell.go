@@ -3,8 +3,6 @@ package cmd
 import (
 	"context"
 	"fmt"
-	"os"
-	"os/exec"
 
 	"github.com/spf13/cobra"
 	"github.com/t-eckert/homelab/spark/internal/k8s"
@@ -13,9 +11,20 @@ import (
 
 var shellCmd = &cobra.Command{
 	Use:   "shell [spark-name]",
-	Short: "SSH into an existing spark",
-	Long:  `Open an SSH connection to an existing spark dev environment`,
-	Args:  cobra.ExactArgs(1),
+	Short: "Open a shell in an existing spark",
+	Long: `Open an SSH connection to an existing spark dev environment.
+
+The built-in SSH client verifies the spark against its pinned host key and
+authenticates with the keys in your SSH agent and SSH_PRIVATE_KEY_PATH.
+Sparks created before host keys were pinned are checked against
+~/.ssh/known_hosts, asking whether to trust and pin a key seen for the first
+time. Use --system-ssh to connect with your OpenSSH client and config
+instead.
+
+When the spark's tailnet hostname does not resolve, for example because the
+Tailscale operator is down, the shell is opened through the Kubernetes exec
+API instead. Use --via exec to always do so.`,
+	Args: sparkNameArg,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		sparkName := args[0]
 		ctx := context.Background()
@@ -38,15 +47,9 @@ var shellCmd = &cobra.Command{
 
 		fmt.Printf("Connecting to spark: %s\n", sparkName)
 
-		// SSH into the spark
-		sshCmd := exec.Command("ssh", fmt.Sprintf("user@spark-%s", sparkName))
-		sshCmd.Stdin = os.Stdin
-		sshCmd.Stdout = os.Stdout
-		sshCmd.Stderr = os.Stderr
-
-		err = sshCmd.Run()
+		err = connectToSpark(ctx, k8sClient, sparkName)
 		if err != nil {
-			return fmt.Errorf("failed to SSH into spark: %w", err)
+			return fmt.Errorf("failed to connect to spark: %w", err)
 		}
 
 		return nil
@@ -55,4 +58,5 @@ var shellCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(shellCmd)
+	addSSHFlags(shellCmd)
 }
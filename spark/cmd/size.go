@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var (
+	createSize sizeFlags
+	resizeSize sizeFlags
+)
+
+var resizeCmd = &cobra.Command{
+	Use:   "resize [spark-name]",
+	Short: "Change a spark's CPU and memory limits",
+	Long: `Change the CPU and memory limits of a spark to a size preset or explicit
+values. The spark restarts with its new size; its home directory, database
+and everything else are kept.
+
+The size must fit in the spark namespace's resource quotas and on a node,
+including while the new pod starts alongside the old one.
+
+Examples:
+  spark resize brave-dolphin --size large
+  spark resize brave-dolphin --memory 8Gi
+  spark resize brave-dolphin --cpu 4 --memory 16Gi`,
+	Args: sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		if resizeSize == (sizeFlags{}) {
+			return fmt.Errorf("no size given: pass --size, --cpu or --memory")
+		}
+		sizes, err := config.LoadSizes()
+		if err != nil {
+			return err
+		}
+		cpu, memory, err := resizeSize.resolve(sizes)
+		if err != nil {
+			return err
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		fromCPU, fromMemory, err := k8sClient.GetSize(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+		if err := k8sClient.ResizeSpark(ctx, sparkName, cpu, memory); err != nil {
+			return err
+		}
+		toCPU, toMemory, err := k8sClient.GetSize(ctx, sparkName)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Resized %s:\n", sparkName)
+		fmt.Printf("  - CPU:    %s → %s\n", fromCPU, toCPU)
+		fmt.Printf("  - Memory: %s → %s\n", fromMemory, toMemory)
+		fmt.Printf("%s is restarting with its new size\n", sparkName)
+		return nil
+	},
+}
+
+// sizeFlags holds the command-line flags choosing a spark's CPU and memory
+// limits.
+type sizeFlags struct {
+	size   string
+	cpu    string
+	memory string
+}
+
+// register adds the size flags to flags.
+func (f *sizeFlags) register(flags *pflag.FlagSet) {
+	flags.StringVar(&f.size, "size", "", "Size preset, small, medium, large, xl or one defined in config.yaml")
+	flags.StringVar(&f.cpu, "cpu", "", "CPU limit, overriding --size (e.g. 2 or 1500m)")
+	flags.StringVar(&f.memory, "memory", "", "Memory limit, overriding --size (e.g. 8Gi)")
+}
+
+// resolve returns the CPU and memory limits chosen by the flags, empty for
+// those they leave out, checking that a spark can be given them.
+func (f *sizeFlags) resolve(sizes map[string]config.Size) (cpu, memory string, err error) {
+	if f.size != "" {
+		size, ok := sizes[f.size]
+		if !ok {
+			names := make([]string, 0, len(sizes))
+			for name := range sizes {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", "", fmt.Errorf("unknown size %q, expected one of %s", f.size, strings.Join(names, ", "))
+		}
+		cpu, memory = size.CPU, size.Memory
+	}
+	if f.cpu != "" {
+		cpu = f.cpu
+	}
+	if f.memory != "" {
+		memory = f.memory
+	}
+
+	resources := &k8s.SparkResources{CPU: cpu, Memory: memory}
+	if err := resources.Validate(); err != nil {
+		return "", "", err
+	}
+	return cpu, memory, nil
+}
+
+func init() {
+	rootCmd.AddCommand(resizeCmd)
+	resizeSize.register(resizeCmd.Flags())
+}
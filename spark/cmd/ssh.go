@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/sshclient"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
+	"golang.org/x/crypto/ssh"
+)
+
+// sparkUser is the login user inside every spark.
+const sparkUser = "user"
+
+// Transports for reaching a spark's shell.
+const (
+	viaAuto = "auto"
+	viaSSH  = "ssh"
+	viaExec = "exec"
+)
+
+var (
+	useSystemSSH bool
+	forwardAgent bool
+	connectVia   string
+)
+
+// pinHostKey writes the spark's host key to the local known_hosts file so the
+// first connection is verified instead of trusted on first use. Failures are
+// reported but not fatal, since SSH will still prompt for the key.
+func pinHostKey(sparkName, publicKey string) {
+	if publicKey == "" {
+		return
+	}
+	err := sshkeys.AddKnownHost(sshkeys.KnownHostsPath(), k8s.TailscaleHostname(sparkName), publicKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to pin host key for %s: %v\n", sparkName, err)
+	}
+}
+
+// ensureHostKeyPinned fetches the spark's host key from the cluster and pins
+// it locally, so connecting from a machine other than the one that created
+// the spark is verified too. It returns the key, which is empty for sparks
+// created before host keys were persisted.
+func ensureHostKeyPinned(ctx context.Context, k8sClient *k8s.Client, sparkName string) string {
+	publicKey, err := k8sClient.GetHostPublicKey(ctx, sparkName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to get host key for %s: %v\n", sparkName, err)
+		return ""
+	}
+	pinHostKey(sparkName, publicKey)
+	return publicKey
+}
+
+// trustHostKey asks whether to trust the host key of a spark created before
+// host keys were persisted, which has none to pin, and pins it if so.
+func trustHostKey(sparkName string, key ssh.PublicKey) bool {
+	host := k8s.TailscaleHostname(sparkName)
+	fmt.Printf("The authenticity of host %s can't be established.\n", host)
+	fmt.Printf("%s key fingerprint is %s.\n", key.Type(), ssh.FingerprintSHA256(key))
+	if !confirm("Trust it and add it to known_hosts?") {
+		return false
+	}
+	pinHostKey(sparkName, string(ssh.MarshalAuthorizedKey(key)))
+	return true
+}
+
+// connectToSpark opens an interactive shell in the spark. It connects over
+// SSH, with the built-in client unless --system-ssh was given, or through the
+// Kubernetes exec API with --via exec or when the spark's tailnet hostname
+// does not resolve.
+func connectToSpark(ctx context.Context, k8sClient *k8s.Client, sparkName string) error {
+	host := k8s.TailscaleHostname(sparkName)
+
+	via := connectVia
+	switch via {
+	case viaAuto:
+		via = viaSSH
+		if _, err := net.LookupHost(host); err != nil {
+			fmt.Printf("%s does not resolve, connecting through the Kubernetes exec API instead\n", host)
+			via = viaExec
+		}
+	case viaSSH, viaExec:
+	default:
+		return fmt.Errorf("invalid --via %q (expected auto, ssh or exec)", connectVia)
+	}
+
+	if via == viaExec {
+		return execShell(ctx, k8sClient, sparkName)
+	}
+
+	hostKey := ensureHostKeyPinned(ctx, k8sClient, sparkName)
+
+	if useSystemSSH {
+		args := []string{}
+		if forwardAgent {
+			args = append(args, "-A")
+		}
+		args = append(args, fmt.Sprintf("%s@%s", sparkUser, host))
+		sshCmd := exec.Command("ssh", args...)
+		sshCmd.Stdin = os.Stdin
+		sshCmd.Stdout = os.Stdout
+		sshCmd.Stderr = os.Stderr
+		return sshCmd.Run()
+	}
+
+	client, err := sshclient.Dial(sshclient.Options{
+		Host:           host,
+		User:           sparkUser,
+		HostKey:        hostKey,
+		KnownHostsPath: sshkeys.KnownHostsPath(),
+		PrivateKeyPath: config.SSHPrivateKeyPath(),
+		TrustHostKey: func(key ssh.PublicKey) bool {
+			return trustHostKey(sparkName, key)
+		},
+	})
+	if errors.Is(err, sshclient.ErrHostKeyUnknown) {
+		return fmt.Errorf("%w; accept the key when asked or connect with --system-ssh", err)
+	}
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.Shell(forwardAgent)
+}
+
+// addSSHFlags registers the flags controlling how a command connects to a
+// spark.
+func addSSHFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&useSystemSSH, "system-ssh", false, "Connect with the system ssh command instead of the built-in client")
+	cmd.Flags().BoolVarP(&forwardAgent, "forward-agent", "A", false, "Forward the local SSH agent into the spark")
+	cmd.Flags().StringVar(&connectVia, "via", viaAuto, "How to reach the spark: ssh, exec (Kubernetes exec API) or auto (ssh, falling back to exec when the hostname does not resolve)")
+}
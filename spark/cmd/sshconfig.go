@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+	"github.com/t-eckert/homelab/spark/internal/sshkeys"
+)
+
+var (
+	sshConfigWrite         bool
+	sshConfigLocalForwards []string
+	sshConfigResetForwards bool
+)
+
+var sshConfigCmd = &cobra.Command{
+	Use:   "ssh-config",
+	Short: "Generate ~/.ssh/config entries for sparks",
+	Long: `Generate a Host entry for every spark, so plain ssh, scp, rsync, SSHFS and
+editors such as VS Code Remote-SSH work with spark names directly:
+
+  ssh brave-dolphin
+  rsync -a ./data brave-dolphin:project/
+
+The entries are printed by default, ready to be redirected into a file. With
+--write they are kept in a managed block of ~/.ssh/config, which 'spark
+create' and 'spark delete' then update automatically, and the sparks' host
+keys are pinned in ~/.ssh/known_hosts. Content outside the block is never
+changed.
+
+Local forwards added with --local-forward are kept when the block is
+rewritten, until --reset-forwards is given.
+
+Examples:
+  spark ssh-config
+  spark ssh-config --write
+  spark ssh-config --write --local-forward brave-dolphin:3000 --local-forward brave-dolphin:8080:80`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := context.Background()
+
+		forwards, err := parseLocalForwards(sshConfigLocalForwards)
+		if err != nil {
+			return err
+		}
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		entries, err := buildSSHConfigEntries(ctx, k8sClient, forwards, sshConfigResetForwards, sshConfigWrite)
+		if err != nil {
+			return err
+		}
+
+		if !sshConfigWrite {
+			fmt.Print(sshkeys.RenderManagedBlock(entries))
+			return nil
+		}
+
+		path := sshkeys.SSHConfigPath()
+		if err := sshkeys.WriteManagedBlock(path, entries); err != nil {
+			return err
+		}
+		fmt.Printf("Updated %s with %d spark(s)\n", path, len(entries))
+		return nil
+	},
+}
+
+// buildSSHConfigEntries returns a Host entry for every spark, pinning each
+// spark's host key so the entries verify it if pin is set. Local forwards
+// already in the managed block are kept unless reset, and forwards are added
+// to them. Warnings go to stderr, leaving stdout to the entries.
+func buildSSHConfigEntries(ctx context.Context, k8sClient *k8s.Client, forwards map[string][]string, reset, pin bool) ([]sshkeys.HostEntry, error) {
+	sparks, err := k8sClient.ListSparks(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sparks: %w", err)
+	}
+
+	existing, _, err := sshkeys.ReadManagedBlock(sshkeys.SSHConfigPath())
+	if err != nil {
+		return nil, err
+	}
+	existingForwards := make(map[string][]string, len(existing))
+	if !reset {
+		for _, entry := range existing {
+			existingForwards[entry.Name] = entry.LocalForwards
+		}
+	}
+
+	entries := make([]sshkeys.HostEntry, 0, len(sparks))
+	for _, sparkName := range sparks {
+		entry, err := sshConfigEntry(ctx, k8sClient, sparkName, pin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping %s: %v\n", sparkName, err)
+			continue
+		}
+		entry.LocalForwards = appendUnique(existingForwards[sparkName], forwards[sparkName]...)
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// sshConfigEntry returns the Host entry of a spark, without local forwards,
+// pinning its host key if pin is set.
+func sshConfigEntry(ctx context.Context, k8sClient *k8s.Client, sparkName string, pin bool) (sshkeys.HostEntry, error) {
+	hostName, err := k8sClient.GetSSHHostname(ctx, sparkName)
+	if err != nil {
+		return sshkeys.HostEntry{}, err
+	}
+	if pin {
+		ensureHostKeyPinned(ctx, k8sClient, sparkName)
+	}
+	return sshkeys.HostEntry{
+		Name:         sparkName,
+		HostName:     hostName,
+		User:         sparkUser,
+		IdentityFile: homeRelative(config.SSHPrivateKeyPath()),
+		HostKeyAlias: k8s.TailscaleHostname(sparkName),
+	}, nil
+}
+
+// refreshSSHConfig rewrites the managed block of ~/.ssh/config after sparks
+// are created or deleted. It does nothing unless the block was written with
+// 'spark ssh-config --write', and failures are reported but not fatal.
+func refreshSSHConfig(ctx context.Context, k8sClient *k8s.Client) {
+	path := sshkeys.SSHConfigPath()
+	_, found, err := sshkeys.ReadManagedBlock(path)
+	if err == nil && !found {
+		return
+	}
+	if err == nil {
+		var entries []sshkeys.HostEntry
+		entries, err = buildSSHConfigEntries(ctx, k8sClient, nil, false, true)
+		if err == nil {
+			err = sshkeys.WriteManagedBlock(path, entries)
+		}
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to update %s: %v\n", path, err)
+	}
+}
+
+// parseLocalForwards parses "spark:port" and "spark:local:remote" flags into
+// LocalForward arguments keyed by spark name.
+func parseLocalForwards(values []string) (map[string][]string, error) {
+	forwards := make(map[string][]string)
+	for _, value := range values {
+		sparkName, mapping, ok := strings.Cut(value, ":")
+		if !ok || strings.HasPrefix(mapping, ":") {
+			return nil, fmt.Errorf("invalid --local-forward %q: expected spark:port or spark:local:remote", value)
+		}
+		if err := names.Validate(sparkName); err != nil {
+			return nil, err
+		}
+		if err := validatePortMapping(mapping); err != nil {
+			return nil, err
+		}
+
+		local, remote, ok := strings.Cut(mapping, ":")
+		if !ok {
+			remote = local
+		}
+		forwards[sparkName] = append(forwards[sparkName], fmt.Sprintf("%s localhost:%s", local, remote))
+	}
+	return forwards, nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		found := false
+		for _, existing := range list {
+			if existing == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// homeRelative abbreviates paths under the home directory with ~, as is
+// conventional in ~/.ssh/config.
+func homeRelative(path string) string {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return path
+	}
+	if rel, err := filepath.Rel(home, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(filepath.Join("~", rel))
+	}
+	return path
+}
+
+func init() {
+	rootCmd.AddCommand(sshConfigCmd)
+	sshConfigCmd.Flags().BoolVar(&sshConfigWrite, "write", false, "Write the entries to a managed block in ~/.ssh/config")
+	sshConfigCmd.Flags().StringArrayVar(&sshConfigLocalForwards, "local-forward", nil, "Add a LocalForward as spark:port or spark:local:remote (repeatable)")
+	sshConfigCmd.Flags().BoolVar(&sshConfigResetForwards, "reset-forwards", false, "Drop local forwards kept from the existing managed block")
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+)
+
+var statusCmd = &cobra.Command{
+	Use:   "status [spark-name]",
+	Short: "Show the details of a spark",
+	Long:  `Show the status, connection details and exposed ports of a spark`,
+	Args:  sparkNameArg,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		ctx := context.Background()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		deployment, err := k8sClient.GetDeployment(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("spark %s not found: %w", sparkName, err)
+		}
+
+		status := "Not Ready"
+		if deployment.Status.ReadyReplicas > 0 {
+			status = "Ready"
+		}
+
+		pod := "none"
+		if p, err := k8sClient.GetSparkPod(ctx, sparkName); err == nil {
+			pod = fmt.Sprintf("%s (%s)", p.Name, p.Status.Phase)
+		}
+
+		fmt.Printf("Spark: %s\n", sparkName)
+		fmt.Printf("  Status:   %s\n", status)
+		fmt.Printf("  Pod:      %s\n", pod)
+		fmt.Printf("  Created:  %s\n", deployment.CreationTimestamp.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("  SSH:      ssh %s@%s\n", sparkUser, k8s.TailscaleHostname(sparkName))
+		fmt.Printf("  Database: %s\n", sparkName)
+		if cpu, memory, err := k8sClient.GetSize(ctx, sparkName); err == nil {
+			fmt.Printf("  Size:     %s CPU, %s memory\n", cpu, memory)
+		}
+
+		exposures, err := k8sClient.ListExposures(ctx, sparkName)
+		if err != nil {
+			return fmt.Errorf("failed to list exposed ports: %w", err)
+		}
+		if len(exposures) > 0 {
+			fmt.Printf("  Exposed:\n")
+			printExposures(exposures)
+		}
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/filesync"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/names"
+	utilexec "k8s.io/client-go/util/exec"
+)
+
+var (
+	syncExclude  []string
+	syncInterval time.Duration
+)
+
+var syncCmd = &cobra.Command{
+	Use:   "sync [spark-name] [local-dir] [remote-dir]",
+	Short: "Continuously sync a local directory with a spark",
+	Long: `Keep a local directory and a directory inside a spark in sync in both
+directions until interrupted, so you can edit locally while running code
+inside the spark. The remote directory defaults to /home/user/<local-dir name>
+and is relative to /home/user unless absolute.
+
+Sync starts by reconciling both sides: files on only one side are copied to
+the other, and files that differ on both are treated as conflicts. After
+that, changes are watched for locally and, when inotifywait (inotify-tools)
+is installed, in the spark. A side that can't be watched is checked every
+--interval instead, and each check lists the whole remote directory. A file
+changed on both sides is a conflict: the newer version wins and the other is
+kept beside it as <name>.sync-conflict-<time>.<ext>.
+
+Files matched by .gitignore files or --exclude are left alone, as is .git.
+Empty directories are not synced.
+
+Examples:
+  spark sync brave-dolphin ./api
+  spark sync brave-dolphin . project --exclude '*.csv'`,
+	Args: syncArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sparkName := args[0]
+		if syncInterval <= 0 {
+			return fmt.Errorf("--interval must be positive")
+		}
+
+		localDir, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		if info, err := os.Stat(localDir); err != nil {
+			return err
+		} else if !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", localDir)
+		}
+
+		remoteDir := path.Join(sparkHome, filepath.Base(localDir))
+		if len(args) == 3 {
+			remoteDir = args[2]
+			if !path.IsAbs(remoteDir) {
+				remoteDir = path.Join(sparkHome, remoteDir)
+			}
+		}
+
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+
+		k8sClient, err := k8s.NewClient()
+		if err != nil {
+			return fmt.Errorf("failed to create k8s client: %w", err)
+		}
+
+		syncer := filesync.New(sparkRunner(k8sClient, sparkName), filesync.Options{
+			LocalDir:  localDir,
+			RemoteDir: remoteDir,
+			Exclude:   syncExclude,
+			Interval:  syncInterval,
+			Log: func(format string, args ...any) {
+				fmt.Printf("%s %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+			},
+		})
+
+		fmt.Printf("Syncing %s with %s:%s (Ctrl+C to stop)\n", localDir, sparkName, remoteDir)
+		return syncer.Run(ctx)
+	},
+}
+
+// syncArgs requires a spark name and a local directory, with an optional
+// remote directory.
+func syncArgs(cmd *cobra.Command, args []string) error {
+	if err := cobra.RangeArgs(2, 3)(cmd, args); err != nil {
+		return err
+	}
+	return names.Validate(args[0])
+}
+
+// sparkRunner runs commands as the spark user through the Kubernetes exec
+// API, so synced files are owned by them.
+func sparkRunner(k8sClient *k8s.Client, sparkName string) filesync.Runner {
+	return func(ctx context.Context, command []string, stdin io.Reader, stdout io.Writer) error {
+		var stderr bytes.Buffer
+		err := k8sClient.Exec(ctx, sparkName, k8s.ExecOptions{
+			Command: append([]string{"runuser", "-u", sparkUser, "--"}, command...),
+			Stdin:   stdin,
+			Stdout:  stdout,
+			Stderr:  &stderr,
+		})
+		var exitErr utilexec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return errors.New(strings.TrimSpace(stderr.String()))
+		}
+		return err
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(syncCmd)
+	syncCmd.Flags().StringArrayVar(&syncExclude, "exclude", nil, "Also ignore files matching a .gitignore-style pattern (repeatable)")
+	syncCmd.Flags().DurationVar(&syncInterval, "interval", 2*time.Second, "How often to check for changes when a side can't be watched")
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/t-eckert/homelab/spark/internal/config"
+	"github.com/t-eckert/homelab/spark/internal/db"
+	"github.com/t-eckert/homelab/spark/internal/k8s"
+	"github.com/t-eckert/homelab/spark/internal/templates"
+)
+
+var templatesCmd = &cobra.Command{
+	Use:   "templates",
+	Short: "List and show spark templates",
+	Long: `Templates are YAML profiles describing the environment a spark is created
+with: base image, apt packages, language runtimes, environment variables,
+resources, storage, add-ons, database seeds and post-create commands.
+
+Templates are loaded from:
+  - the built-in templates
+  - ~/.config/spark/templates/<name>.yaml, which hide built-in templates of
+    the same name
+  - .spark/templates/<name>.yaml in the current repository, named
+    repo:<name> so they are only used when asked for
+
+Create a spark from one with: spark create --template <name>`,
+}
+
+var templatesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available templates",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		list, err := templates.List(config.Dir())
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Templates (%d):\n\n", len(list))
+		for _, t := range list {
+			if t.Hides != "" {
+				fmt.Printf("  - %s (%s, hiding %s)\n", t.Name, t.Source, t.Hides)
+			} else {
+				fmt.Printf("  - %s (%s)\n", t.Name, t.Source)
+			}
+			if t.Description != "" {
+				fmt.Printf("    %s\n", t.Description)
+			}
+		}
+		return nil
+	},
+}
+
+var templatesShowCmd = &cobra.Command{
+	Use:   "show [template]",
+	Short: "Show a template with the templates it extends merged in",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		t, err := loadTemplate(args[0])
+		if err != nil {
+			return err
+		}
+		out, err := t.YAML()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("# %s (%s)\n%s", t.Name, t.Source, out)
+		return nil
+	},
+}
+
+// loadTemplate resolves a template and checks that a spark can be created
+// from it, warning about templates hiding built-in ones.
+func loadTemplate(name string) (*templates.Template, error) {
+	t, err := templates.Load(config.Dir(), name)
+	if err != nil {
+		return nil, err
+	}
+	for _, override := range t.Overrides {
+		fmt.Fprintf(os.Stderr, "Warning: using template %s instead of the built-in one\n", override)
+	}
+	resources := &k8s.SparkResources{}
+	applyTemplate(resources, t)
+	if err := resources.Validate(); err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// applyTemplate sets the spark's environment from a resolved template.
+func applyTemplate(resources *k8s.SparkResources, t *templates.Template) {
+	resources.Image = t.Image
+	resources.Packages = t.Packages
+	resources.Runtimes = t.Runtimes
+	resources.Env = t.Env
+	resources.CPU = t.Resources.CPU
+	resources.Memory = t.Resources.Memory
+	resources.Storage = t.Storage
+	resources.Addons = t.Addons
+	resources.PostCreate = t.PostCreate
+}
+
+// seedDatabase runs a template's database seeds against the spark's
+// database. They run as the configured Postgres user, which owns the objects
+// they create; it is also the user in the spark's DATABASE_URL, so the spark
+// can use and alter them.
+func seedDatabase(cfg *config.Config, sparkName string, seeds []templates.Seed) error {
+	client, err := db.NewClient(db.BuildConnectionString(
+		cfg.PostgresHost,
+		cfg.PostgresPort,
+		cfg.PostgresUser,
+		sparkName,
+	), cfg.PostgresPassword)
+	if err != nil {
+		return fmt.Errorf("failed to connect to spark database: %w", err)
+	}
+	defer client.Close()
+
+	for _, seed := range seeds {
+		fmt.Printf("Seeding database from %s...\n", seed.Name)
+		if err := client.RunScript(seed.SQL); err != nil {
+			return fmt.Errorf("%s: %w", seed.Name, err)
+		}
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(templatesCmd)
+	templatesCmd.AddCommand(templatesListCmd)
+	templatesCmd.AddCommand(templatesShowCmd)
+}
@@ -0,0 +1,235 @@
+// Package archive streams files and directories as tar archives, for copying
+// them to and from sparks.
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Owner is the uid and gid given to archived files, so they belong to the
+// spark user when extracted inside a spark.
+const Owner = 1000
+
+// Excluded reports whether rel, a slash-separated path relative to the root
+// of a copy, matches any of the patterns. A pattern matches the base name of
+// a file or its whole relative path, as with tar --exclude.
+func Excluded(rel string, patterns []string) bool {
+	base := path.Base(rel)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, base); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Write archives the file or directory at src to w, naming the top-level
+// entry name. Files matching exclude are skipped, along with the contents of
+// excluded directories.
+func Write(w io.Writer, src, name string, exclude []string) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.WalkDir(src, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && Excluded(rel, exclude) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			// Sockets, devices and the like can't be copied meaningfully
+			return nil
+		}
+
+		return writeEntry(tw, file, path.Join(name, rel), info, link)
+	})
+	if err != nil {
+		return err
+	}
+
+	return tw.Close()
+}
+
+// WriteFiles archives the regular files and symlinks at the slash-separated
+// paths files, relative to root, under their relative names.
+func WriteFiles(w io.Writer, root string, files []string) error {
+	tw := tar.NewWriter(w)
+
+	for _, rel := range files {
+		file := filepath.Join(root, filepath.FromSlash(rel))
+		info, err := os.Lstat(file)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+		if err := writeEntry(tw, file, rel, info, link); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func writeEntry(tw *tar.Writer, file, name string, info fs.FileInfo, link string) error {
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Uid, header.Gid = Owner, Owner
+	header.Uname, header.Gname = "", ""
+
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Extract unpacks the archive read from r into dir, renaming its top-level
+// entry to name, or keeping entry names if name is empty. Files keep their
+// archived modification times. Entries that would land outside dir are rejected, and
+// symlinks are created last so no file is written through one. Directory
+// permissions are applied last too, so read-only directories can be filled.
+func Extract(r io.Reader, dir, name string) error {
+	tr := tar.NewReader(r)
+	var links []*tar.Header
+	dirModes := make(map[string]fs.FileMode)
+
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := extractPath(dir, name, header.Name)
+		if err != nil {
+			return err
+		}
+		mode := fs.FileMode(header.Mode).Perm()
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+			dirModes[target] = mode
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			if err := writeFile(target, tr, mode); err != nil {
+				return err
+			}
+			if err := os.Chtimes(target, header.ModTime, header.ModTime); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			header.Name = target
+			links = append(links, header)
+		}
+	}
+
+	for _, link := range links {
+		if err := os.MkdirAll(filepath.Dir(link.Name), 0o755); err != nil {
+			return err
+		}
+		_ = os.Remove(link.Name)
+		if err := os.Symlink(link.Linkname, link.Name); err != nil {
+			return err
+		}
+	}
+
+	for target, mode := range dirModes {
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractPath maps an archive entry to its path under dir, replacing the
+// entry's top-level component with name unless name is empty.
+func extractPath(dir, name, entry string) (string, error) {
+	entry = path.Clean(strings.TrimPrefix(entry, "./"))
+	rest := entry
+	if name != "" {
+		_, rest, _ = strings.Cut(entry, "/")
+	}
+
+	target := filepath.Join(dir, name, filepath.FromSlash(rest))
+	rel, err := filepath.Rel(dir, target)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %q is outside the destination", entry)
+	}
+	return target, nil
+}
+
+func writeFile(target string, r io.Reader, mode fs.FileMode) error {
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// Apply the mode even to existing files, which OpenFile leaves alone
+	return os.Chmod(target, mode)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 )
 
 // Config holds the application configuration loaded from environment variables.
@@ -16,6 +18,27 @@ type Config struct {
 	PostgresUser     string
 	PostgresPassword string
 	PostgresDB       string
+
+	// Credentials used to read application databases cloned into sparks.
+	SourcePostgresUser     string
+	SourcePostgresPassword string
+
+	// Default limits applied to each spark's database.
+	DBConnectionLimit          int
+	DBStatementTimeout         string
+	DBIdleInTransactionTimeout string
+	DBWorkMem                  string
+
+	// Domain and Traefik entry point for ports exposed with --ingress.
+	IngressDomain     string
+	IngressEntryPoint string
+
+	// Identity is read from the configuration file and the local git config.
+	Identity Identity
+
+	// Sizes are the spark size presets, the defaults merged with those in
+	// the configuration file.
+	Sizes map[string]Size
 }
 
 // Load reads configuration from environment variables and returns a Config struct.
@@ -28,10 +51,35 @@ func Load() (*Config, error) {
 		PostgresUser:     getEnvOrDefault("POSTGRES_USER", "spark"),
 		PostgresPassword: os.Getenv("POSTGRES_PASSWORD"),
 		PostgresDB:       getEnvOrDefault("POSTGRES_DB", "homelab"),
+
+		DBStatementTimeout:         getEnvOrDefault("SPARK_DB_STATEMENT_TIMEOUT", "5min"),
+		DBIdleInTransactionTimeout: getEnvOrDefault("SPARK_DB_IDLE_IN_TRANSACTION_TIMEOUT", "10min"),
+		DBWorkMem:                  getEnvOrDefault("SPARK_DB_WORK_MEM", "16MB"),
+
+		IngressDomain:     getEnvOrDefault("SPARK_INGRESS_DOMAIN", "feist-gondola.ts.net"),
+		IngressEntryPoint: getEnvOrDefault("SPARK_INGRESS_ENTRYPOINT", "web"),
 	}
 
+	connLimit, err := strconv.Atoi(getEnvOrDefault("SPARK_DB_CONNECTION_LIMIT", "10"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid SPARK_DB_CONNECTION_LIMIT: %w", err)
+	}
+	cfg.DBConnectionLimit = connLimit
+
+	cfg.Identity, err = LoadIdentity()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Sizes, err = LoadSizes()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.SourcePostgresUser = getEnvOrDefault("SPARK_SOURCE_POSTGRES_USER", cfg.PostgresUser)
+	cfg.SourcePostgresPassword = getEnvOrDefault("SPARK_SOURCE_POSTGRES_PASSWORD", cfg.PostgresPassword)
+
 	// Load SSH public key
-	sshKeyPath := getEnvOrDefault("SSH_PUBLIC_KEY_PATH", filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519.pub"))
+	sshKeyPath := SSHPublicKeyPath()
 	sshKey, err := os.ReadFile(sshKeyPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read SSH public key from %s: %w", sshKeyPath, err)
@@ -50,6 +98,34 @@ func Load() (*Config, error) {
 	return cfg, nil
 }
 
+// Dir returns the directory holding spark's local configuration and state,
+// $XDG_CONFIG_HOME/spark or ~/.config/spark.
+func Dir() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		base = filepath.Join(os.Getenv("HOME"), ".config")
+	}
+	return filepath.Join(base, "spark")
+}
+
+// SSHPublicKeyPath returns the path of the SSH public key authorized to log
+// into sparks.
+func SSHPublicKeyPath() string {
+	return getEnvOrDefault("SSH_PUBLIC_KEY_PATH", filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519.pub"))
+}
+
+// SSHPrivateKeyPath returns the path of the private key matching
+// SSHPublicKeyPath, used by the built-in SSH client when no agent has it.
+func SSHPrivateKeyPath() string {
+	return getEnvOrDefault("SSH_PRIVATE_KEY_PATH", strings.TrimSuffix(SSHPublicKeyPath(), ".pub"))
+}
+
+// Editor returns the editor 'spark code' opens sparks in: code, cursor, zed
+// or a command template.
+func Editor() string {
+	return getEnvOrDefault("SPARK_EDITOR", "code")
+}
+
 func getEnvOrDefault(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
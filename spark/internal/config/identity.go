@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Identity is who sparks are set up for: the dotfiles installed in them,
+// the author of commits made in them, the GitHub user their token belongs to
+// and their login shell.
+type Identity struct {
+	Dotfiles struct {
+		// Repo is cloned into ~/.dotfiles. A GitHub owner/repo is enough.
+		Repo string `yaml:"repo"`
+		// Install is run in the clone. It defaults to the first of the
+		// usual install scripts that exists.
+		Install string `yaml:"install"`
+	} `yaml:"dotfiles"`
+	Git struct {
+		Name  string `yaml:"name"`
+		Email string `yaml:"email"`
+	} `yaml:"git"`
+	GitHub struct {
+		User string `yaml:"user"`
+	} `yaml:"github"`
+	Shell string `yaml:"shell"`
+}
+
+// FilePath returns the path of spark's configuration file.
+func FilePath() string {
+	return filepath.Join(Dir(), "config.yaml")
+}
+
+// LoadIdentity reads the identity from the configuration file, filling in
+// the git author and GitHub user it leaves out from the local git config.
+func LoadIdentity() (Identity, error) {
+	var identity Identity
+	if err := readFile(&identity); err != nil {
+		return identity, err
+	}
+
+	for key, value := range map[string]*string{
+		"user.name":   &identity.Git.Name,
+		"user.email":  &identity.Git.Email,
+		"github.user": &identity.GitHub.User,
+	} {
+		if *value == "" {
+			*value = gitConfig(key)
+		}
+	}
+	return identity, nil
+}
+
+// readFile parses the configuration file into v, leaving it untouched if
+// the file doesn't exist.
+func readFile(v any) error {
+	data, err := os.ReadFile(FilePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", FilePath(), err)
+	}
+	if err := yaml.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", FilePath(), err)
+	}
+	return nil
+}
+
+// gitConfig returns a value of the local git config, or an empty string if
+// it isn't set or git isn't installed.
+func gitConfig(key string) string {
+	out, err := exec.Command("git", "config", "--get", key).Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
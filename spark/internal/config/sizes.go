@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Size is a preset of a spark container's CPU and memory limits.
+type Size struct {
+	CPU    string `yaml:"cpu"`
+	Memory string `yaml:"memory"`
+}
+
+// DefaultSize is the size of sparks whose template doesn't set resources.
+const DefaultSize = "medium"
+
+// DefaultSizes are the presets available without configuration. The
+// configuration file's sizes section can redefine them or add more:
+//
+//	sizes:
+//	  large:
+//	    cpu: "3"
+//	    memory: 6Gi
+//	  gpu-box:
+//	    cpu: "8"
+//	    memory: 32Gi
+var DefaultSizes = map[string]Size{
+	"small":  {CPU: "500m", Memory: "1Gi"},
+	"medium": {CPU: "1000m", Memory: "2Gi"},
+	"large":  {CPU: "2000m", Memory: "4Gi"},
+	"xl":     {CPU: "4000m", Memory: "16Gi"},
+}
+
+// LoadSizes returns the default size presets with those of the
+// configuration file applied. A preset that leaves out cpu or memory keeps
+// the default's. Every preset is checked, so a mistake in the file fails
+// before a spark is created with it.
+func LoadSizes() (map[string]Size, error) {
+	var file struct {
+		Sizes map[string]Size `yaml:"sizes"`
+	}
+	if err := readFile(&file); err != nil {
+		return nil, err
+	}
+
+	sizes := make(map[string]Size, len(DefaultSizes)+len(file.Sizes))
+	for name, size := range DefaultSizes {
+		sizes[name] = size
+	}
+	for name, size := range file.Sizes {
+		if size.CPU == "" {
+			size.CPU = sizes[name].CPU
+		}
+		if size.Memory == "" {
+			size.Memory = sizes[name].Memory
+		}
+		sizes[name] = size
+	}
+	for name, size := range sizes {
+		if err := size.validate(); err != nil {
+			return nil, fmt.Errorf("invalid size %s in config: %w", name, err)
+		}
+	}
+	return sizes, nil
+}
+
+// validate checks that the size's limits are positive quantities.
+func (s Size) validate() error {
+	for name, value := range map[string]string{"cpu": s.CPU, "memory": s.Memory} {
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+		if quantity.Sign() <= 0 {
+			return fmt.Errorf("invalid %s %q: must be more than zero", name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/t-eckert/homelab/spark/internal/names"
+)
+
+// checkpointSeparator joins a spark name and a checkpoint label into the name
+// of the database holding the checkpoint. Spark names cannot contain '_', so
+// the separator is unambiguous.
+const checkpointSeparator = "__"
+
+// rollbackLabel names the database a checkpoint is copied into during a
+// rollback. The underscore keeps it apart from user-chosen labels.
+const rollbackLabel = "rollback_tmp"
+
+// Checkpoint is a saved copy of a spark's database.
+type Checkpoint struct {
+	Label     string
+	Database  string
+	CreatedAt time.Time
+	SizeBytes int64
+}
+
+// CheckpointDatabaseName returns the name of the database holding the given
+// checkpoint of a spark.
+func CheckpointDatabaseName(sparkName, label string) string {
+	return sparkName + checkpointSeparator + label
+}
+
+// SparkNameForDatabase returns the spark a database belongs to, which is the
+// database name itself for a spark's main database and the part before the
+// separator for a checkpoint.
+func SparkNameForDatabase(database string) string {
+	sparkName, _, _ := strings.Cut(database, checkpointSeparator)
+	return sparkName
+}
+
+// IsSparkDatabase reports whether a database is named like a spark's main
+// database or one of its checkpoints, so databases spark didn't create are
+// left alone.
+func IsSparkDatabase(database string) bool {
+	sparkName, label, isCheckpoint := strings.Cut(database, checkpointSeparator)
+	if names.Validate(sparkName) != nil {
+		return false
+	}
+	return !isCheckpoint || label == rollbackLabel || names.ValidateCheckpointRef(label) == nil
+}
+
+// CreateCheckpoint saves a copy of the spark's database under label.
+//
+// Postgres can only copy a database that has no other sessions, so any
+// connections to the spark's database are terminated first.
+func (c *Client) CreateCheckpoint(name, label string) error {
+	if err := names.ValidateCheckpointLabel(label); err != nil {
+		return err
+	}
+	checkpoint := CheckpointDatabaseName(name, label)
+
+	var exists bool
+	err := c.conn.QueryRow("SELECT EXISTS(SELECT datname FROM pg_catalog.pg_database WHERE datname = $1)", checkpoint).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if checkpoint exists: %w", err)
+	}
+	if exists {
+		return fmt.Errorf("checkpoint %s already exists for %s", label, name)
+	}
+
+	if err := c.copyDatabase(name, checkpoint); err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	return c.stampCheckpoint(checkpoint)
+}
+
+// ListCheckpoints returns the checkpoints saved for a spark, oldest first.
+func (c *Client) ListCheckpoints(name string) ([]Checkpoint, error) {
+	prefix := name + checkpointSeparator
+	rows, err := c.conn.Query(`
+		SELECT datname,
+			COALESCE(shobj_description(oid, 'pg_database'), ''),
+			pg_database_size(oid)
+		FROM pg_catalog.pg_database
+		WHERE left(datname, length($1)) = $1`, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+	defer rows.Close()
+
+	var checkpoints []Checkpoint
+	for rows.Next() {
+		var checkpoint Checkpoint
+		var createdAt string
+		if err := rows.Scan(&checkpoint.Database, &createdAt, &checkpoint.SizeBytes); err != nil {
+			return nil, fmt.Errorf("failed to scan checkpoint: %w", err)
+		}
+		checkpoint.Label = strings.TrimPrefix(checkpoint.Database, prefix)
+		if checkpoint.Label == rollbackLabel {
+			// Left behind by an interrupted rollback, not a checkpoint
+			continue
+		}
+		checkpoint.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+		checkpoints = append(checkpoints, checkpoint)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list checkpoints: %w", err)
+	}
+
+	// Sort in Go since the creation time lives in the database comment
+	sort.Slice(checkpoints, func(i, j int) bool {
+		return checkpoints[i].CreatedAt.Before(checkpoints[j].CreatedAt)
+	})
+
+	return checkpoints, nil
+}
+
+// RollbackCheckpoint replaces the spark's database with a copy of the
+// checkpoint saved under label. The checkpoint itself is kept so it can be
+// rolled back to again, and the replaced database is saved as the
+// "pre-rollback" checkpoint. The database limits are carried over to the new
+// copy.
+//
+// The checkpoint is copied to a temporary database first, so a failed copy
+// leaves the spark's database and its pre-rollback checkpoint untouched.
+func (c *Client) RollbackCheckpoint(name, label string) error {
+	if err := names.ValidateCheckpointRef(label); err != nil {
+		return err
+	}
+	checkpoint := CheckpointDatabaseName(name, label)
+	preRollback := CheckpointDatabaseName(name, names.PreRollbackLabel)
+	rollback := CheckpointDatabaseName(name, rollbackLabel)
+
+	var exists bool
+	err := c.conn.QueryRow("SELECT EXISTS(SELECT datname FROM pg_catalog.pg_database WHERE datname = $1)", checkpoint).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check if checkpoint exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("checkpoint %s does not exist for %s", label, name)
+	}
+
+	limits, err := c.GetLimits(name)
+	if err != nil {
+		return err
+	}
+
+	// Copy the checkpoint before touching anything, dropping what an
+	// interrupted rollback may have left behind
+	if err := c.DeleteDatabase(rollback); err != nil {
+		return err
+	}
+	if err := c.copyDatabase(checkpoint, rollback); err != nil {
+		_ = c.DeleteDatabase(rollback)
+		return fmt.Errorf("failed to copy checkpoint: %w", err)
+	}
+
+	// Move the current database aside so the rollback can be undone. When
+	// rolling back to the pre-rollback checkpoint itself, its copy is
+	// already safe in the temporary database.
+	if err := c.DeleteDatabase(preRollback); err != nil {
+		_ = c.DeleteDatabase(rollback)
+		return err
+	}
+	if err := c.renameDatabase(name, preRollback); err != nil {
+		_ = c.DeleteDatabase(rollback)
+		return fmt.Errorf("failed to save current database: %w", err)
+	}
+	if err := c.stampCheckpoint(preRollback); err != nil {
+		// Put the original database back
+		if restoreErr := c.renameDatabase(preRollback, name); restoreErr != nil {
+			return fmt.Errorf("%w (and failed to restore original database: %v)", err, restoreErr)
+		}
+		_ = c.DeleteDatabase(rollback)
+		return err
+	}
+
+	if err := c.renameDatabase(rollback, name); err != nil {
+		// Put the original database back
+		if restoreErr := c.renameDatabase(preRollback, name); restoreErr != nil {
+			return fmt.Errorf("failed to restore checkpoint: %w (and failed to restore original database: %v)", err, restoreErr)
+		}
+		_ = c.DeleteDatabase(rollback)
+		return fmt.Errorf("failed to restore checkpoint: %w", err)
+	}
+
+	if err := c.SetLimits(name, *limits); err != nil {
+		return fmt.Errorf("failed to reapply database limits: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteCheckpoints drops every checkpoint saved for a spark, and the
+// temporary database of an interrupted rollback.
+func (c *Client) DeleteCheckpoints(name string) error {
+	checkpoints, err := c.ListCheckpoints(name)
+	if err != nil {
+		return err
+	}
+	if err := c.DeleteDatabase(CheckpointDatabaseName(name, rollbackLabel)); err != nil {
+		return err
+	}
+	for _, checkpoint := range checkpoints {
+		if err := c.DeleteDatabase(checkpoint.Database); err != nil {
+			return fmt.Errorf("failed to delete checkpoint %s: %w", checkpoint.Label, err)
+		}
+	}
+	return nil
+}
+
+// stampCheckpoint records the current time as the checkpoint's creation time
+// in the database comment.
+func (c *Client) stampCheckpoint(database string) error {
+	_, err := c.conn.Exec(fmt.Sprintf("COMMENT ON DATABASE %s IS %s",
+		pq.QuoteIdentifier(database),
+		pq.QuoteLiteral(time.Now().UTC().Format(time.RFC3339))))
+	if err != nil {
+		return fmt.Errorf("failed to record checkpoint time: %w", err)
+	}
+	return nil
+}
+
+// copyDatabase creates target as a server-side copy of source.
+func (c *Client) copyDatabase(source, target string) error {
+	if err := c.terminateConnections(source); err != nil {
+		return err
+	}
+	_, err := c.conn.Exec(fmt.Sprintf("CREATE DATABASE %s TEMPLATE %s",
+		pq.QuoteIdentifier(target),
+		pq.QuoteIdentifier(source)))
+	return err
+}
+
+// renameDatabase renames a database after disconnecting its sessions.
+func (c *Client) renameDatabase(from, to string) error {
+	if err := c.terminateConnections(from); err != nil {
+		return err
+	}
+	_, err := c.conn.Exec(fmt.Sprintf("ALTER DATABASE %s RENAME TO %s",
+		pq.QuoteIdentifier(from),
+		pq.QuoteIdentifier(to)))
+	return err
+}
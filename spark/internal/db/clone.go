@@ -0,0 +1,368 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// foreignKeyPattern matches foreign key constraints in pg_dump output so they
+// can be added as NOT VALID, since sampled tables will not satisfy them.
+var foreignKeyPattern = regexp.MustCompile(`(?s)(ALTER TABLE [^;]*? FOREIGN KEY [^;]*?);\n`)
+
+// sourceTable is a table to copy from the source database.
+type sourceTable struct {
+	schema  string
+	name    string
+	columns []string
+	// types describes each column, for checking the masks applied to it.
+	types map[string]sourceColumn
+}
+
+// sourceColumn is what a mask needs to know about a column to fit in it.
+type sourceColumn struct {
+	typeName string
+	// text is set for string types, and maxLength for those limited in
+	// length such as varchar(n).
+	text      bool
+	maxLength int
+	notNull   bool
+	// unique is set for columns in a primary key or unique index, which are
+	// restored after the rows are copied.
+	unique bool
+}
+
+func (t sourceTable) qualifiedName() string {
+	return t.schema + "." + t.name
+}
+
+// CheckMaskRules checks the mask rules against the tables of the database
+// c is connected to, so rules that would fail the clone are rejected before
+// anything is copied.
+func (c *Client) CheckMaskRules(rules *MaskRules) error {
+	tables, err := c.listTables()
+	if err != nil {
+		return err
+	}
+	return rules.check(tables)
+}
+
+// CloneFrom copies the schema and data of source into the database c is
+// connected to, sampling rows and masking columns according to rules. The
+// schema is copied with pg_dump, which must be installed locally. Progress
+// messages are passed to progress as the clone proceeds.
+//
+// Hashed columns use a key generated for the clone and never stored, so
+// values are consistent within the clone but can't be recovered from it.
+func (c *Client) CloneFrom(source *Client, rules *MaskRules, progress func(string)) error {
+	tables, err := source.listTables()
+	if err != nil {
+		return err
+	}
+
+	if err := rules.check(tables); err != nil {
+		return err
+	}
+
+	key, err := newMaskKey()
+	if err != nil {
+		return err
+	}
+
+	progress("Copying schema...")
+	preData, err := source.dumpSchema("pre-data")
+	if err != nil {
+		return err
+	}
+	if err := c.execScript(preData); err != nil {
+		return fmt.Errorf("failed to create schema: %w", err)
+	}
+
+	for _, table := range tables {
+		rows, err := c.copyTable(source, table, rules, key)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s: %w", table.qualifiedName(), err)
+		}
+		progress(fmt.Sprintf("Copied %s (%d rows)", table.qualifiedName(), rows))
+	}
+
+	progress("Copying constraints and indexes...")
+	postData, err := source.dumpSchema("post-data")
+	if err != nil {
+		return err
+	}
+	postData = foreignKeyPattern.ReplaceAllString(postData, "$1 NOT VALID;\n")
+	if err := c.execScript(postData); err != nil {
+		return fmt.Errorf("failed to create constraints and indexes: %w", err)
+	}
+
+	if err := c.copySequences(source); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// check makes sure every table and column named in the rules exists, so a
+// typo cannot silently copy data that was meant to be masked, and that each
+// mask fits its column's type and constraints.
+func (r *MaskRules) check(tables []sourceTable) error {
+	if r == nil {
+		return nil
+	}
+
+	columns := make(map[string]map[string]sourceColumn, len(tables))
+	for _, table := range tables {
+		columns[table.qualifiedName()] = table.types
+	}
+
+	for table, rule := range r.Tables {
+		tableColumns, ok := columns[table]
+		if !ok {
+			return fmt.Errorf("mask rules refer to table %s, which does not exist in the source database", table)
+		}
+		for column, spec := range rule.Columns {
+			info, ok := tableColumns[column]
+			if !ok {
+				return fmt.Errorf("mask rules refer to column %s.%s, which does not exist in the source database", table, column)
+			}
+			mask, err := parseColumnMask(spec)
+			if err != nil {
+				return fmt.Errorf("table %s column %s: %w", table, column, err)
+			}
+			if err := mask.fits(info); err != nil {
+				return fmt.Errorf("cannot mask %s.%s: %w", table, column, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// listTables returns the ordinary tables in all non-system schemas along with
+// their writable columns.
+func (c *Client) listTables() ([]sourceTable, error) {
+	rows, err := c.conn.Query(`
+		SELECT n.nspname, cl.relname, a.attname,
+			format_type(a.atttypid, a.atttypmod),
+			t.typcategory = 'S',
+			CASE WHEN t.typname IN ('varchar', 'bpchar') AND a.atttypmod > 4
+				THEN a.atttypmod - 4 ELSE 0 END,
+			a.attnotnull,
+			EXISTS(SELECT 1 FROM pg_catalog.pg_index i
+				WHERE i.indrelid = cl.oid AND i.indisunique AND a.attnum = ANY(i.indkey))
+		FROM pg_catalog.pg_class cl
+		JOIN pg_catalog.pg_namespace n ON n.oid = cl.relnamespace
+		JOIN pg_catalog.pg_attribute a ON a.attrelid = cl.oid
+		JOIN pg_catalog.pg_type t ON t.oid = a.atttypid
+		WHERE cl.relkind = 'r'
+			AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+			AND n.nspname NOT LIKE 'pg\_%'
+			AND a.attnum > 0
+			AND NOT a.attisdropped
+			AND a.attgenerated = ''
+		ORDER BY n.nspname, cl.relname, a.attnum`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []sourceTable
+	for rows.Next() {
+		var schema, name, column string
+		var info sourceColumn
+		if err := rows.Scan(&schema, &name, &column, &info.typeName, &info.text, &info.maxLength, &info.notNull, &info.unique); err != nil {
+			return nil, fmt.Errorf("failed to scan table: %w", err)
+		}
+		if n := len(tables); n == 0 || tables[n-1].schema != schema || tables[n-1].name != name {
+			tables = append(tables, sourceTable{schema: schema, name: name, types: make(map[string]sourceColumn)})
+		}
+		table := &tables[len(tables)-1]
+		table.columns = append(table.columns, column)
+		table.types[column] = info
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	return tables, nil
+}
+
+// dumpSchema runs pg_dump for one section ("pre-data" or "post-data") of the
+// schema and returns the SQL.
+func (c *Client) dumpSchema(section string) (string, error) {
+	cmd := exec.Command("pg_dump",
+		"--host", c.host,
+		"--port", c.port,
+		"--username", c.user,
+		// A bare name containing '=' would be read as connection parameters
+		"--dbname", "dbname="+quoteDSNValue(c.database),
+		"--section", section,
+		"--no-owner",
+		"--no-privileges",
+		"--no-comments",
+		"--no-publications",
+		"--no-subscriptions",
+	)
+	cmd.Env = append(os.Environ(), "PGPASSWORD="+c.password)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if execErr, ok := err.(*exec.Error); ok {
+			return "", fmt.Errorf("pg_dump is required to clone a database: %w", execErr)
+		}
+		return "", fmt.Errorf("pg_dump failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+// execScript runs a SQL script produced by pg_dump. psql meta-commands such
+// as \restrict are dropped, and session settings changed by the script are
+// reset afterwards.
+func (c *Client) execScript(script string) error {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if strings.HasPrefix(line, "\\") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "RESET ALL;")
+
+	_, err := c.conn.Exec(strings.Join(lines, "\n"))
+	return err
+}
+
+// copyTable copies the sampled, masked rows of one table from source,
+// hashing with key, and returns the number of rows copied.
+func (c *Client) copyTable(source *Client, table sourceTable, rules *MaskRules, key []byte) (int64, error) {
+	rule := rules.table(table.qualifiedName())
+	if rule.Skip {
+		return 0, nil
+	}
+
+	masks := make([]*columnMask, len(table.columns))
+	selects := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		selects[i] = pq.QuoteIdentifier(column) + "::text"
+		if spec, ok := rule.Columns[column]; ok {
+			mask, err := parseColumnMask(spec)
+			if err != nil {
+				return 0, err
+			}
+			masks[i] = &mask
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM ONLY %s.%s",
+		strings.Join(selects, ", "),
+		pq.QuoteIdentifier(table.schema),
+		pq.QuoteIdentifier(table.name))
+	if sample := rules.sample(table.qualifiedName()); sample > 0 && sample < 100 {
+		query += fmt.Sprintf(" TABLESAMPLE BERNOULLI (%g)", sample)
+	}
+	if rule.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", rule.Limit)
+	}
+
+	rows, err := source.conn.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	tx, err := c.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(pq.CopyInSchema(table.schema, table.name, table.columns...))
+	if err != nil {
+		return 0, err
+	}
+
+	values := make([]sql.NullString, len(table.columns))
+	scanArgs := make([]any, len(values))
+	for i := range values {
+		scanArgs[i] = &values[i]
+	}
+	row := make([]any, len(values))
+
+	var count int64
+	for rows.Next() {
+		if err := rows.Scan(scanArgs...); err != nil {
+			return 0, err
+		}
+		for i, value := range values {
+			var text *string
+			if value.Valid {
+				text = &value.String
+			}
+			if masks[i] != nil {
+				text = masks[i].apply(text, key)
+			}
+			if text == nil {
+				row[i] = nil
+			} else {
+				row[i] = *text
+			}
+		}
+		if _, err := stmt.Exec(row...); err != nil {
+			return 0, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if _, err := stmt.Exec(); err != nil {
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	return count, tx.Commit()
+}
+
+// copySequences sets every sequence to its value in source so new rows do not
+// collide with copied ones.
+func (c *Client) copySequences(source *Client) error {
+	rows, err := source.conn.Query(`
+		SELECT schemaname, sequencename, last_value
+		FROM pg_catalog.pg_sequences
+		WHERE last_value IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to list sequences: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name string
+		var lastValue int64
+		if err := rows.Scan(&schema, &name, &lastValue); err != nil {
+			return fmt.Errorf("failed to scan sequence: %w", err)
+		}
+		sequence := pq.QuoteIdentifier(schema) + "." + pq.QuoteIdentifier(name)
+		_, err := c.conn.Exec("SELECT pg_catalog.setval($1, $2)", sequence, lastValue)
+		if err != nil {
+			return fmt.Errorf("failed to set sequence %s: %w", sequence, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list sequences: %w", err)
+	}
+
+	return nil
+}
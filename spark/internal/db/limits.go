@@ -0,0 +1,87 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Limits holds the resource limits applied to a spark's database.
+//
+// Settings are applied with ALTER DATABASE, which the spark role is allowed to
+// run on databases it owns, so they apply to every session in that database
+// without touching the shared role. An empty setting resets it to the server
+// default and a connection limit of -1 means unlimited.
+type Limits struct {
+	ConnectionLimit          int
+	StatementTimeout         string
+	IdleInTransactionTimeout string
+	WorkMem                  string
+}
+
+// settings maps Postgres setting names to the Limits field holding them.
+func (l *Limits) settings() map[string]*string {
+	return map[string]*string{
+		"statement_timeout":                   &l.StatementTimeout,
+		"idle_in_transaction_session_timeout": &l.IdleInTransactionTimeout,
+		"work_mem":                            &l.WorkMem,
+	}
+}
+
+// SetLimits applies the given limits to the named database.
+func (c *Client) SetLimits(name string, limits Limits) error {
+	database := pq.QuoteIdentifier(name)
+
+	_, err := c.conn.Exec(fmt.Sprintf("ALTER DATABASE %s CONNECTION LIMIT %d", database, limits.ConnectionLimit))
+	if err != nil {
+		return fmt.Errorf("failed to set connection limit: %w", err)
+	}
+
+	for setting, value := range limits.settings() {
+		var query string
+		if *value == "" {
+			query = fmt.Sprintf("ALTER DATABASE %s RESET %s", database, setting)
+		} else {
+			query = fmt.Sprintf("ALTER DATABASE %s SET %s = %s", database, setting, pq.QuoteLiteral(*value))
+		}
+		if _, err := c.conn.Exec(query); err != nil {
+			return fmt.Errorf("failed to set %s: %w", setting, err)
+		}
+	}
+
+	return nil
+}
+
+// GetLimits returns the limits currently applied to the named database.
+func (c *Client) GetLimits(name string) (*Limits, error) {
+	limits := &Limits{}
+
+	var configs pq.StringArray
+	err := c.conn.QueryRow(`
+		SELECT d.datconnlimit, s.setconfig
+		FROM pg_catalog.pg_database d
+		LEFT JOIN pg_catalog.pg_db_role_setting s
+			ON s.setdatabase = d.oid AND s.setrole = 0
+		WHERE d.datname = $1`, name).Scan(&limits.ConnectionLimit, &configs)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("database %s does not exist", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database limits: %w", err)
+	}
+
+	settings := limits.settings()
+	for _, config := range configs {
+		setting, value, ok := strings.Cut(config, "=")
+		if !ok {
+			continue
+		}
+		if field, ok := settings[setting]; ok {
+			*field = value
+		}
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// MaskRules describes how to sample and anonymize a database while cloning
+// it into a spark. Rules are loaded from a YAML file such as:
+//
+//	sample: 10          # default percentage of rows to copy from each table
+//	tables:
+//	  public.users:
+//	    limit: 500      # copy at most 500 rows
+//	    columns:
+//	      email: fake_email
+//	      name: hash
+//	      bio: truncate:20
+//	      password_hash: null
+//	  public.audit_log:
+//	    skip: true      # create the table but copy no rows
+type MaskRules struct {
+	// Sample is the default percentage of rows copied from each table. Zero
+	// copies every row.
+	Sample float64               `yaml:"sample"`
+	Tables map[string]*TableRule `yaml:"tables"`
+}
+
+// TableRule holds the sampling and masking rules for a single table, keyed by
+// its schema-qualified name.
+type TableRule struct {
+	Sample  *float64          `yaml:"sample"`
+	Limit   int64             `yaml:"limit"`
+	Skip    bool              `yaml:"skip"`
+	Columns map[string]string `yaml:"columns"`
+}
+
+// Mask strategies that can be applied to a column.
+const (
+	MaskNull      = "null"
+	MaskHash      = "hash"
+	MaskFakeEmail = "fake_email"
+	MaskTruncate  = "truncate"
+)
+
+// columnMask is a parsed column rule.
+type columnMask struct {
+	strategy string
+	length   int
+}
+
+// LoadMaskRules reads masking rules from a YAML file.
+func LoadMaskRules(path string) (*MaskRules, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mask rules from %s: %w", path, err)
+	}
+
+	rules := &MaskRules{}
+	if err := yaml.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("failed to parse mask rules from %s: %w", path, err)
+	}
+
+	if err := rules.validate(); err != nil {
+		return nil, fmt.Errorf("invalid mask rules in %s: %w", path, err)
+	}
+
+	return rules, nil
+}
+
+func (r *MaskRules) validate() error {
+	if r.Sample < 0 || r.Sample > 100 {
+		return fmt.Errorf("sample must be between 0 and 100, got %v", r.Sample)
+	}
+	for table, rule := range r.Tables {
+		if rule == nil {
+			return fmt.Errorf("table %s has no rules", table)
+		}
+		if !strings.Contains(table, ".") {
+			return fmt.Errorf("table %s must be schema-qualified, e.g. public.%s", table, table)
+		}
+		if rule.Sample != nil && (*rule.Sample < 0 || *rule.Sample > 100) {
+			return fmt.Errorf("table %s: sample must be between 0 and 100, got %v", table, *rule.Sample)
+		}
+		if rule.Limit < 0 {
+			return fmt.Errorf("table %s: limit must not be negative", table)
+		}
+		for column, spec := range rule.Columns {
+			if _, err := parseColumnMask(spec); err != nil {
+				return fmt.Errorf("table %s column %s: %w", table, column, err)
+			}
+		}
+	}
+	return nil
+}
+
+// table returns the rule for a schema-qualified table, or an empty rule.
+func (r *MaskRules) table(name string) *TableRule {
+	if r != nil {
+		if rule, ok := r.Tables[name]; ok {
+			return rule
+		}
+	}
+	return &TableRule{}
+}
+
+// sample returns the percentage of rows to copy from a table.
+func (r *MaskRules) sample(name string) float64 {
+	if rule := r.table(name); rule.Sample != nil {
+		return *rule.Sample
+	}
+	if r == nil {
+		return 0
+	}
+	return r.Sample
+}
+
+// parseColumnMask parses a column rule such as "hash" or "truncate:20". An
+// empty rule, which is what YAML gives for a bare null, masks to NULL.
+func parseColumnMask(spec string) (columnMask, error) {
+	strategy, arg, hasArg := strings.Cut(spec, ":")
+	switch strategy {
+	case "", MaskNull:
+		return columnMask{strategy: MaskNull}, nil
+	case MaskHash, MaskFakeEmail:
+		if hasArg {
+			return columnMask{}, fmt.Errorf("%s takes no argument", strategy)
+		}
+		return columnMask{strategy: strategy}, nil
+	case MaskTruncate:
+		length, err := strconv.Atoi(arg)
+		if !hasArg || err != nil || length < 0 {
+			return columnMask{}, fmt.Errorf("truncate requires a length, e.g. truncate:20")
+		}
+		return columnMask{strategy: strategy, length: length}, nil
+	default:
+		return columnMask{}, fmt.Errorf("unknown mask %q (expected null, hash, fake_email or truncate:N)", spec)
+	}
+}
+
+// fits checks that the mask's values can be stored in a column. Masks
+// other than null produce text, and only null and hash keep the values of
+// a unique column unique: truncated values and the short digests of fake
+// emails can collide, failing the clone once its constraints are restored.
+func (m columnMask) fits(column sourceColumn) error {
+	if m.strategy == MaskNull {
+		if column.notNull {
+			return fmt.Errorf("null on a NOT NULL column")
+		}
+		return nil
+	}
+	if !column.text {
+		return fmt.Errorf("%s on a %s column; only text columns can be masked with it, other types with null", m.strategy, column.typeName)
+	}
+	if column.unique && m.strategy != MaskHash {
+		return fmt.Errorf("%s on a column with a unique constraint can produce duplicates; use hash instead", m.strategy)
+	}
+	if length := m.maxLength(); column.maxLength > 0 && length > column.maxLength {
+		return fmt.Errorf("%s produces values of up to %d characters, longer than %s allows", m.strategy, length, column.typeName)
+	}
+	return nil
+}
+
+// maxLength returns the longest value the mask produces, or zero when that
+// depends on the original value.
+func (m columnMask) maxLength() int {
+	switch m.strategy {
+	case MaskHash:
+		return len(digest(nil, ""))
+	case MaskFakeEmail:
+		return len(fakeEmail(nil, ""))
+	}
+	return 0
+}
+
+// apply masks a single column value, hashing with key. Values are the text
+// representation of the column, and nil is SQL NULL, which is never
+// unmasked into a value.
+func (m columnMask) apply(value *string, key []byte) *string {
+	if value == nil {
+		return nil
+	}
+	switch m.strategy {
+	case MaskHash:
+		masked := digest(key, *value)
+		return &masked
+	case MaskFakeEmail:
+		masked := fakeEmail(key, *value)
+		return &masked
+	case MaskTruncate:
+		runes := []rune(*value)
+		if len(runes) <= m.length {
+			return value
+		}
+		masked := string(runes[:m.length])
+		return &masked
+	default:
+		return nil
+	}
+}
+
+// fakeEmail returns an example.com address derived from a value.
+func fakeEmail(key []byte, value string) string {
+	return "user-" + digest(key, value)[:12] + "@example.com"
+}
+
+// newMaskKey returns a random key for hashing the values of one clone.
+func newMaskKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate masking key: %w", err)
+	}
+	return key, nil
+}
+
+// digest hashes a value with an HMAC, so masked columns stay joinable and
+// unique values stay unique within a clone. A plain hash would let anyone
+// recover values such as emails by hashing guesses; the key is thrown away
+// after the clone, so its values can't be checked against guesses.
+func digest(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
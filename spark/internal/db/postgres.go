@@ -4,23 +4,40 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"strings"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"github.com/t-eckert/homelab/spark/internal/names"
 )
 
 type Client struct {
 	conn *sql.DB
+
+	// Connection parameters, kept for tools such as pg_dump that need to
+	// open their own connection.
+	host     string
+	port     string
+	user     string
+	password string
+	database string
 }
 
 func NewClient(connectionString string, password string) (*Client, error) {
 	// Build connection string with password in URI format
 	// The PGPASSWORD environment variable doesn't work with lib/pq DSN format
+	client := &Client{
+		host:     extractHost(connectionString),
+		port:     extractPort(connectionString),
+		user:     extractUser(connectionString),
+		password: password,
+		database: extractDatabase(connectionString),
+	}
 	connWithPassword := BuildConnectionURI(
-		extractHost(connectionString),
-		extractPort(connectionString),
-		extractUser(connectionString),
-		password,
-		extractDatabase(connectionString),
+		client.host,
+		client.port,
+		client.user,
+		client.password,
+		client.database,
 	)
 
 	conn, err := sql.Open("postgres", connWithPassword)
@@ -33,7 +50,8 @@ func NewClient(connectionString string, password string) (*Client, error) {
 		return nil, fmt.Errorf("failed to ping postgres: %w", err)
 	}
 
-	return &Client{conn: conn}, nil
+	client.conn = conn
+	return client, nil
 }
 
 func extractHost(dsn string) string {
@@ -68,16 +86,27 @@ func parseDSN(dsn string) map[string]string {
 	return parts
 }
 
+// splitDSN splits a DSN into its key=value pairs, unquoting values quoted
+// by quoteDSNValue.
 func splitDSN(s string) []string {
 	var result []string
 	var current string
+	quoted, escaped := false, false
 	for _, char := range s {
-		if char == ' ' {
+		switch {
+		case escaped:
+			current += string(char)
+			escaped = false
+		case quoted && char == '\\':
+			escaped = true
+		case char == '\'':
+			quoted = !quoted
+		case char == ' ' && !quoted:
 			if current != "" {
 				result = append(result, current)
 				current = ""
 			}
-		} else {
+		default:
 			current += string(char)
 		}
 	}
@@ -87,6 +116,14 @@ func splitDSN(s string) []string {
 	return result
 }
 
+// quoteDSNValue quotes a value for a key=value DSN, so spaces and quotes in
+// it can't add other parameters.
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
 func splitPair(s string, sep rune) []string {
 	idx := -1
 	for i, char := range s {
@@ -102,6 +139,10 @@ func splitPair(s string, sep rune) []string {
 }
 
 func (c *Client) CreateDatabase(name string) error {
+	if err := names.Validate(name); err != nil {
+		return err
+	}
+
 	// Check if database already exists
 	var exists bool
 	err := c.conn.QueryRow("SELECT EXISTS(SELECT datname FROM pg_catalog.pg_database WHERE datname = $1)", name).Scan(&exists)
@@ -114,7 +155,7 @@ func (c *Client) CreateDatabase(name string) error {
 	}
 
 	// Create database
-	_, err = c.conn.Exec(fmt.Sprintf("CREATE DATABASE %q", name))
+	_, err = c.conn.Exec("CREATE DATABASE " + pq.QuoteIdentifier(name))
 	if err != nil {
 		return fmt.Errorf("failed to create database: %w", err)
 	}
@@ -123,18 +164,13 @@ func (c *Client) CreateDatabase(name string) error {
 }
 
 func (c *Client) DeleteDatabase(name string) error {
-	// Terminate existing connections
-	_, err := c.conn.Exec(fmt.Sprintf(`
-		SELECT pg_terminate_backend(pg_stat_activity.pid)
-		FROM pg_stat_activity
-		WHERE pg_stat_activity.datname = '%s'
-		AND pid <> pg_backend_pid()`, name))
+	err := c.terminateConnections(name)
 	if err != nil {
-		return fmt.Errorf("failed to terminate connections: %w", err)
+		return err
 	}
 
 	// Drop database
-	_, err = c.conn.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %q", name))
+	_, err = c.conn.Exec("DROP DATABASE IF EXISTS " + pq.QuoteIdentifier(name))
 	if err != nil {
 		return fmt.Errorf("failed to drop database: %w", err)
 	}
@@ -142,6 +178,48 @@ func (c *Client) DeleteDatabase(name string) error {
 	return nil
 }
 
+// terminateConnections closes every other session connected to the named
+// database.
+func (c *Client) terminateConnections(name string) error {
+	_, err := c.conn.Exec(`
+		SELECT pg_terminate_backend(pg_stat_activity.pid)
+		FROM pg_stat_activity
+		WHERE pg_stat_activity.datname = $1
+		AND pid <> pg_backend_pid()`, name)
+	if err != nil {
+		return fmt.Errorf("failed to terminate connections: %w", err)
+	}
+	return nil
+}
+
+// ListOwnedDatabases returns the names of all databases owned by the
+// connected role.
+func (c *Client) ListOwnedDatabases() ([]string, error) {
+	rows, err := c.conn.Query(`
+		SELECT datname
+		FROM pg_catalog.pg_database
+		WHERE datdba = (SELECT oid FROM pg_catalog.pg_roles WHERE rolname = current_user)
+		ORDER BY datname`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	defer rows.Close()
+
+	var databases []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan database name: %w", err)
+		}
+		databases = append(databases, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	return databases, nil
+}
+
 func (c *Client) Close() error {
 	return c.conn.Close()
 }
@@ -149,7 +227,7 @@ func (c *Client) Close() error {
 func BuildConnectionString(host, port, user, database string) string {
 	// Don't include password in connection string - it will be set via PGPASSWORD env var
 	return fmt.Sprintf("host=%s port=%s user=%s dbname=%s sslmode=disable",
-		host, port, user, database)
+		quoteDSNValue(host), quoteDSNValue(port), quoteDSNValue(user), quoteDSNValue(database))
 }
 
 func BuildConnectionURI(host, port, user, password, database string) string {
@@ -159,5 +237,11 @@ func BuildConnectionURI(host, port, user, password, database string) string {
 		url.QueryEscape(password),
 		host,
 		port,
-		database)
+		url.PathEscape(database))
+}
+
+// RunScript runs a SQL script, such as a template's database seed, in the
+// client's database.
+func (c *Client) RunScript(script string) error {
+	return c.execScript(script)
 }
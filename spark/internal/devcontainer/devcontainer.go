@@ -0,0 +1,221 @@
+// Package devcontainer reads a repository's devcontainer.json and translates
+// the parts spark can honor into its own settings.
+package devcontainer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Paths are where a repository can keep its devcontainer.json, in the order
+// they are tried.
+var Paths = []string{".devcontainer/devcontainer.json", ".devcontainer.json"}
+
+// ErrNotFound is returned by Fetch when a repository has no devcontainer.json.
+var ErrNotFound = errors.New("no devcontainer.json found")
+
+// commitPattern matches refs that are commit hashes rather than branch or
+// tag names.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// Config is a parsed devcontainer.json. Only the properties spark honors are
+// decoded; the others are kept by name to be reported as ignored.
+type Config struct {
+	// Path is the file's path in the repository.
+	Path string `json:"-"`
+
+	Name                 string                     `json:"name"`
+	Image                string                     `json:"image"`
+	ContainerEnv         map[string]string          `json:"containerEnv"`
+	RemoteEnv            map[string]*string         `json:"remoteEnv"`
+	ForwardPorts         []json.RawMessage          `json:"forwardPorts"`
+	OnCreateCommand      json.RawMessage            `json:"onCreateCommand"`
+	UpdateContentCommand json.RawMessage            `json:"updateContentCommand"`
+	PostCreateCommand    json.RawMessage            `json:"postCreateCommand"`
+	PostStartCommand     json.RawMessage            `json:"postStartCommand"`
+	Features             map[string]json.RawMessage `json:"features"`
+
+	// others lists the top-level properties that are not decoded.
+	others []string
+}
+
+// handled are the properties decoded into Config, along with those that
+// need no translation.
+var handled = map[string]bool{
+	"name":                 true,
+	"image":                true,
+	"containerEnv":         true,
+	"remoteEnv":            true,
+	"forwardPorts":         true,
+	"onCreateCommand":      true,
+	"updateContentCommand": true,
+	"postCreateCommand":    true,
+	"postStartCommand":     true,
+	"features":             true,
+	"$schema":              true,
+}
+
+// Parse parses the contents of a devcontainer.json, which may contain
+// comments and trailing commas.
+func Parse(data []byte) (*Config, error) {
+	data = stripJSONC(data)
+
+	cfg := &Config{}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid devcontainer.json: %w", err)
+	}
+
+	var properties map[string]json.RawMessage
+	if err := json.Unmarshal(data, &properties); err != nil {
+		return nil, fmt.Errorf("invalid devcontainer.json: %w", err)
+	}
+	for key := range properties {
+		if !handled[key] {
+			cfg.others = append(cfg.others, key)
+		}
+	}
+	sort.Strings(cfg.others)
+	return cfg, nil
+}
+
+// Fetch reads the devcontainer.json of a git repository at a branch, tag or
+// commit, or its default branch if ref is empty. It makes a blobless clone,
+// shallow unless ref is a commit, in a temporary directory with the local
+// git, so it works with whatever credentials git is configured with.
+func Fetch(ctx context.Context, repo, ref string) (*Config, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	dir, err := os.MkdirTemp("", "spark-devcontainer-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	args := []string{"clone", "--quiet", "--no-checkout", "--filter=blob:none"}
+	rev := "HEAD"
+	switch {
+	case commitPattern.MatchString(ref):
+		// Shallow clones can't be relied on to contain an arbitrary commit
+		rev = ref
+	case ref != "":
+		args = append(args, "--depth", "1", "--branch", ref)
+	default:
+		args = append(args, "--depth", "1")
+	}
+	if _, err := runGit(ctx, "", append(args, "--", repo, dir)...); err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %w", repo, err)
+	}
+
+	for _, path := range Paths {
+		data, err := runGit(ctx, dir, "show", rev+":"+path)
+		if err != nil {
+			continue
+		}
+		cfg, err := Parse(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		cfg.Path = path
+		return cfg, nil
+	}
+	return nil, ErrNotFound
+}
+
+func runGit(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	// Fail rather than wait for a password on the terminal
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, errors.New(msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// stripJSONC removes the comments and trailing commas allowed in
+// devcontainer.json, leaving plain JSON.
+func stripJSONC(data []byte) []byte {
+	return stripTrailingCommas(stripComments(data))
+}
+
+func stripComments(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '/':
+			for i+1 < len(data) && data[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end == -1 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+			out.WriteByte(' ')
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+func stripTrailingCommas(data []byte) []byte {
+	var out bytes.Buffer
+	inString := false
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case inString:
+			out.WriteByte(c)
+			if c == '\\' && i+1 < len(data) {
+				i++
+				out.WriteByte(data[i])
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+			out.WriteByte(c)
+		case c == ',':
+			rest := bytes.TrimLeft(data[i+1:], " \t\r\n")
+			if len(rest) > 0 && (rest[0] == '}' || rest[0] == ']') {
+				continue
+			}
+			out.WriteByte(c)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
@@ -0,0 +1,342 @@
+package devcontainer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Plan is what spark makes of a devcontainer.json: the settings to apply to
+// the spark and a summary of what was applied and what was ignored.
+type Plan struct {
+	Image string
+	Env   map[string]string
+	// LocalEnv are the variables set from the local environment with
+	// ${localEnv:NAME}. They may hold credentials, so they are kept out of
+	// Env and stored in the spark's env Secret.
+	LocalEnv     map[string]string
+	ForwardPorts []string
+	// PostCreate runs once, after the repository is cloned: the
+	// onCreateCommand, updateContentCommand and postCreateCommand in order.
+	PostCreate []string
+	PostStart  []string
+	Packages   []string
+	Runtimes   map[string]string
+
+	Applied []string
+	Ignored []string
+}
+
+// featureRuntimes maps official devcontainer features to the mise tool
+// installing the same runtime.
+var featureRuntimes = map[string]string{
+	"go":        "go",
+	"node":      "node",
+	"python":    "python",
+	"rust":      "rust",
+	"java":      "java",
+	"ruby":      "ruby",
+	"dotnet":    "dotnet",
+	"terraform": "terraform",
+	"aws-cli":   "aws-cli",
+}
+
+// providedFeatures are features whose tools every spark already has.
+var providedFeatures = map[string]bool{
+	"common-utils": true,
+	"git":          true,
+	"sshd":         true,
+}
+
+// featurePrefix is the registry path of the official devcontainer features,
+// the only ones translated.
+const featurePrefix = "ghcr.io/devcontainers/features/"
+
+// Plan translates the configuration for a spark whose repository is cloned
+// into workspaceFolder.
+func (c *Config) Plan(workspaceFolder string) *Plan {
+	p := &Plan{Env: make(map[string]string), LocalEnv: make(map[string]string), Runtimes: make(map[string]string)}
+
+	if c.Image != "" {
+		p.Image = c.Image
+		p.applied("image: %s", c.Image)
+	}
+
+	setEnv := func(property string, env map[string]*string) {
+		var set, local []string
+		for _, name := range sortedKeys(env) {
+			// A null value unsets the variable
+			if env[name] == nil {
+				delete(p.Env, name)
+				delete(p.LocalEnv, name)
+				continue
+			}
+			value, unresolved := substituteVariables(*env[name], c.ContainerEnv, workspaceFolder, false)
+			if len(unresolved) > 0 {
+				p.ignored("%s %s: refers to the image's %s", property, name, strings.Join(unresolved, ", "))
+				continue
+			}
+			if usesLocalEnv(*env[name]) {
+				p.LocalEnv[name] = value
+				delete(p.Env, name)
+				local = append(local, name)
+			} else {
+				p.Env[name] = value
+				delete(p.LocalEnv, name)
+				set = append(set, name)
+			}
+		}
+		if len(set) > 0 {
+			p.applied("%s: %s", property, strings.Join(set, ", "))
+		}
+		if len(local) > 0 {
+			p.applied("%s: %s (from the local environment, kept in the spark's env Secret)", property, strings.Join(local, ", "))
+		}
+	}
+	containerEnv := make(map[string]*string, len(c.ContainerEnv))
+	for name, value := range c.ContainerEnv {
+		value := value
+		containerEnv[name] = &value
+	}
+	setEnv("containerEnv", containerEnv)
+	setEnv("remoteEnv", c.RemoteEnv)
+
+	for _, raw := range c.ForwardPorts {
+		var port int
+		if err := json.Unmarshal(raw, &port); err == nil {
+			p.ForwardPorts = append(p.ForwardPorts, strconv.Itoa(port))
+			continue
+		}
+		var s string
+		_ = json.Unmarshal(raw, &s)
+		if _, err := strconv.Atoi(s); err == nil {
+			p.ForwardPorts = append(p.ForwardPorts, s)
+		} else {
+			p.ignored("forwardPorts %s: only ports of the spark itself can be forwarded", string(raw))
+		}
+	}
+	if len(p.ForwardPorts) > 0 {
+		p.applied("forwardPorts: %s (forward them with 'spark forward <name>')", strings.Join(p.ForwardPorts, ", "))
+	}
+
+	for _, lifecycle := range []struct {
+		name string
+		raw  json.RawMessage
+		into *[]string
+	}{
+		{"onCreateCommand", c.OnCreateCommand, &p.PostCreate},
+		{"updateContentCommand", c.UpdateContentCommand, &p.PostCreate},
+		{"postCreateCommand", c.PostCreateCommand, &p.PostCreate},
+		{"postStartCommand", c.PostStartCommand, &p.PostStart},
+	} {
+		commands, err := parseCommands(lifecycle.raw)
+		if err != nil {
+			p.ignored("%s: %v", lifecycle.name, err)
+			continue
+		}
+		if len(commands) == 0 {
+			continue
+		}
+		for _, command := range commands {
+			command, _ = substituteVariables(command, c.ContainerEnv, workspaceFolder, true)
+			*lifecycle.into = append(*lifecycle.into, command)
+		}
+		p.applied("%s: %s", lifecycle.name, strings.Join(commands, " && "))
+	}
+
+	for _, id := range sortedKeys(c.Features) {
+		p.feature(id, c.Features[id])
+	}
+
+	for _, property := range c.others {
+		p.ignored("%s: not supported", property)
+	}
+
+	return p
+}
+
+// feature translates one feature to packages or runtimes.
+func (p *Plan) feature(id string, raw json.RawMessage) {
+	name := strings.TrimPrefix(id, featurePrefix)
+	if name == id {
+		p.ignored("feature %s: only features from %s are supported", id, featurePrefix)
+		return
+	}
+	// Drop the feature's major version tag
+	name, _, _ = strings.Cut(name, ":")
+
+	options := featureOptions(raw)
+	version := options["version"]
+	switch version {
+	case "none":
+		return
+	case "", "os-provided":
+		version = "latest"
+	}
+
+	switch {
+	case providedFeatures[name]:
+		p.applied("feature %s: already included in every spark", name)
+	case featureRuntimes[name] != "":
+		tool := featureRuntimes[name]
+		p.Runtimes[tool] = version
+		p.applied("feature %s: %s@%s", name, tool, version)
+	case name == "github-cli":
+		p.Packages = append(p.Packages, "gh")
+		p.applied("feature %s: gh package", name)
+	case name == "kubectl-helm-minikube":
+		p.Runtimes["kubectl"] = version
+		if helm := options["helm"]; helm != "none" {
+			p.Runtimes["helm"] = orLatest(helm)
+		}
+		p.applied("feature %s: kubectl and helm", name)
+	default:
+		p.ignored("feature %s: not supported", name)
+	}
+}
+
+// featureOptions returns a feature's options. A feature may be given as an
+// options object or as a version string.
+func featureOptions(raw json.RawMessage) map[string]string {
+	options := make(map[string]string)
+	var version string
+	if err := json.Unmarshal(raw, &version); err == nil {
+		options["version"] = version
+		return options
+	}
+
+	var values map[string]interface{}
+	_ = json.Unmarshal(raw, &values)
+	for key, value := range values {
+		options[key] = fmt.Sprint(value)
+	}
+	return options
+}
+
+// parseCommands parses a lifecycle command, which is a shell command, an
+// array of arguments run without a shell, or an object of named commands of
+// either form.
+func parseCommands(raw json.RawMessage) ([]string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+
+	var command string
+	if err := json.Unmarshal(raw, &command); err == nil {
+		if command == "" {
+			return nil, nil
+		}
+		return []string{command}, nil
+	}
+
+	var args []string
+	if err := json.Unmarshal(raw, &args); err == nil {
+		if len(args) == 0 {
+			return nil, nil
+		}
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellQuote(arg)
+		}
+		return []string{strings.Join(quoted, " ")}, nil
+	}
+
+	// Named commands run in parallel in a dev container; spark runs them
+	// one after another in name order
+	var named map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &named); err != nil {
+		return nil, fmt.Errorf("expected a string, an array or an object")
+	}
+	var commands []string
+	for _, name := range sortedKeys(named) {
+		parsed, err := parseCommands(named[name])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		commands = append(commands, parsed...)
+	}
+	return commands, nil
+}
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z]+)(?::([^}:]*)(?::([^}]*))?)?\}`)
+
+// substituteVariables replaces the devcontainer.json variables that make
+// sense for a spark: ${localEnv:NAME}, ${containerEnv:NAME} and the
+// container workspace folder. Other variables are left as they are.
+//
+// Variables from the image's environment, such as PATH, are only known
+// inside the spark. In commands they become shell expansions; otherwise
+// their names are returned as unresolved.
+func substituteVariables(s string, containerEnv map[string]string, workspaceFolder string, shell bool) (string, []string) {
+	var unresolved []string
+	result := variablePattern.ReplaceAllStringFunc(s, func(match string) string {
+		m := variablePattern.FindStringSubmatch(match)
+		switch m[1] {
+		case "localEnv":
+			if value := os.Getenv(m[2]); value != "" {
+				return value
+			}
+			return m[3]
+		case "containerEnv":
+			if value, ok := containerEnv[m[2]]; ok {
+				return value
+			}
+			if shell {
+				return "${" + m[2] + "}"
+			}
+			unresolved = append(unresolved, m[2])
+			return match
+		case "containerWorkspaceFolder":
+			return workspaceFolder
+		case "containerWorkspaceFolderBasename":
+			return path.Base(workspaceFolder)
+		}
+		return match
+	})
+	return result, unresolved
+}
+
+// usesLocalEnv reports whether s refers to a variable of the local
+// environment.
+func usesLocalEnv(s string) bool {
+	for _, m := range variablePattern.FindAllStringSubmatch(s, -1) {
+		if m[1] == "localEnv" {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Plan) applied(format string, args ...interface{}) {
+	p.Applied = append(p.Applied, fmt.Sprintf(format, args...))
+}
+
+func (p *Plan) ignored(format string, args ...interface{}) {
+	p.Ignored = append(p.Ignored, fmt.Sprintf(format, args...))
+}
+
+func orLatest(version string) string {
+	if version == "" {
+		return "latest"
+	}
+	return version
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
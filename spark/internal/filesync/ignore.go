@@ -0,0 +1,148 @@
+package filesync
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+)
+
+// ignoreRule is a single .gitignore pattern.
+type ignoreRule struct {
+	// dir is the directory of the .gitignore the rule came from, relative
+	// to the sync root, or "" for the root.
+	dir     string
+	pattern *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// Ignorer decides which paths are left out of a sync, following .gitignore
+// semantics.
+type Ignorer struct {
+	rules []ignoreRule
+}
+
+// NewIgnorer returns an Ignorer with extra patterns, written as in a
+// .gitignore at the sync root.
+func NewIgnorer(patterns []string) *Ignorer {
+	ig := &Ignorer{}
+	for _, pattern := range patterns {
+		ig.addPattern("", pattern)
+	}
+	return ig
+}
+
+// AddGitignore adds the rules of the .gitignore in dir, relative to the sync
+// root.
+func (ig *Ignorer) AddGitignore(dir, content string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		ig.addPattern(dir, scanner.Text())
+	}
+}
+
+func (ig *Ignorer) addPattern(dir, line string) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	rule := ignoreRule{dir: dir}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	}
+	line = strings.TrimPrefix(line, "\\")
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+
+	// Patterns containing a slash are relative to the .gitignore's
+	// directory, others match a name at any depth
+	prefix := "(.*/)?"
+	if strings.Contains(line, "/") {
+		prefix = ""
+		line = strings.TrimPrefix(line, "/")
+	}
+
+	pattern, err := regexp.Compile("^" + prefix + globToRegexp(line) + "$")
+	if err != nil {
+		return
+	}
+	rule.pattern = pattern
+	ig.rules = append(ig.rules, rule)
+}
+
+// globToRegexp translates a gitignore glob, including **, to a regular
+// expression.
+func globToRegexp(glob string) string {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("(/.*)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end == -1 {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// Ignored reports whether the slash-separated path rel is ignored. A path is
+// ignored if it, or any directory containing it, matches.
+func (ig *Ignorer) Ignored(rel string, isDir bool) bool {
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		prefix := strings.Join(parts[:i+1], "/")
+		if ig.matches(prefix, isDir || i < len(parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches applies the rules to a single path, the last matching rule
+// deciding as in git.
+func (ig *Ignorer) matches(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		subject := rel
+		if rule.dir != "" {
+			if !strings.HasPrefix(rel, rule.dir+"/") {
+				continue
+			}
+			subject = strings.TrimPrefix(rel, rule.dir+"/")
+		}
+		if rule.pattern.MatchString(subject) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
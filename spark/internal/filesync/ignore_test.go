@@ -0,0 +1,67 @@
+package filesync
+
+import "testing"
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name       string
+		patterns   []string
+		gitignores map[string]string
+		path       string
+		isDir      bool
+		want       bool
+	}{
+		{name: "name at root", patterns: []string{"*.log"}, path: "a.log", want: true},
+		{name: "name at any depth", patterns: []string{"*.log"}, path: "dir/sub/a.log", want: true},
+		{name: "star stops at extension", patterns: []string{"*.log"}, path: "a.log.txt", want: false},
+		{name: "comment", patterns: []string{"#a.log"}, path: "#a.log", want: false},
+		{name: "escaped hash", patterns: []string{`\#notes`}, path: "#notes", want: true},
+		{name: "trailing spaces", patterns: []string{"a.log  "}, path: "a.log", want: true},
+		{name: "question mark", patterns: []string{"a?c"}, path: "abc", want: true},
+		{name: "question mark not slash", patterns: []string{"a?c"}, path: "a/c", want: false},
+		{name: "class", patterns: []string{"file[0-9].txt"}, path: "file7.txt", want: true},
+		{name: "negated class", patterns: []string{"[!a]bc"}, path: "abc", want: false},
+		{name: "negated class other", patterns: []string{"[!a]bc"}, path: "xbc", want: true},
+
+		{name: "dir only matches dir", patterns: []string{"build/"}, path: "build", isDir: true, want: true},
+		{name: "dir only skips file", patterns: []string{"build/"}, path: "build", want: false},
+		{name: "dir only contents", patterns: []string{"build/"}, path: "build/out/main", want: true},
+		{name: "dir only nested", patterns: []string{"build/"}, path: "src/build/main", want: true},
+
+		{name: "anchored at root", patterns: []string{"/root.txt"}, path: "root.txt", want: true},
+		{name: "anchored not nested", patterns: []string{"/root.txt"}, path: "sub/root.txt", want: false},
+		{name: "slash anchors", patterns: []string{"docs/*.md"}, path: "docs/a.md", want: true},
+		{name: "slash star one level", patterns: []string{"docs/*.md"}, path: "docs/sub/a.md", want: false},
+		{name: "slash not nested", patterns: []string{"docs/*.md"}, path: "x/docs/a.md", want: false},
+
+		{name: "leading double star", patterns: []string{"**/logs"}, path: "logs", isDir: true, want: true},
+		{name: "leading double star nested", patterns: []string{"**/logs"}, path: "a/b/logs/x", want: true},
+		{name: "inner double star none", patterns: []string{"a/**/b"}, path: "a/b", want: true},
+		{name: "inner double star many", patterns: []string{"a/**/b"}, path: "a/x/y/b", want: true},
+		{name: "inner double star other", patterns: []string{"a/**/b"}, path: "c/x/b", want: false},
+		{name: "trailing double star", patterns: []string{"out/**"}, path: "out/x/y", want: true},
+		{name: "trailing double star sibling", patterns: []string{"out/**"}, path: "outer/x", want: false},
+
+		{name: "negation after", patterns: []string{"*.log", "!keep.log"}, path: "keep.log", want: false},
+		{name: "negation leaves others", patterns: []string{"*.log", "!keep.log"}, path: "other.log", want: true},
+		{name: "negation before", patterns: []string{"!keep.log", "*.log"}, path: "keep.log", want: true},
+		{name: "negation under ignored dir", patterns: []string{"tmp/", "!tmp/keep"}, path: "tmp/keep", want: true},
+
+		{name: "nested gitignore", gitignores: map[string]string{"sub": "*.tmp\n"}, path: "sub/deep/a.tmp", want: true},
+		{name: "nested gitignore scope", gitignores: map[string]string{"sub": "*.tmp\n"}, path: "a.tmp", want: false},
+		{name: "nested anchored", gitignores: map[string]string{"sub": "/local\n"}, path: "sub/local", want: true},
+		{name: "nested anchored not deeper", gitignores: map[string]string{"sub": "/local\n"}, path: "sub/x/local", want: false},
+		{name: "nested negation", patterns: []string{"*.env"}, gitignores: map[string]string{"sub": "!example.env\n"}, path: "sub/example.env", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ig := NewIgnorer(tt.patterns)
+			for dir, content := range tt.gitignores {
+				ig.AddGitignore(dir, content)
+			}
+			if got := ig.Ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%q, %v) with %q %v = %v, want %v", tt.path, tt.isDir, tt.patterns, tt.gitignores, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package filesync
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// File describes a synced file or symlink. Directories are not tracked; they
+// are created as needed for the files in them.
+type File struct {
+	Symlink bool
+	Size    int64
+	// ModTime is in whole seconds, the precision tar preserves.
+	ModTime int64
+	Mode    fs.FileMode
+	Target  string
+}
+
+// Snapshot maps slash-separated paths relative to a sync root to their files.
+type Snapshot map[string]File
+
+// sameFile reports whether two sides hold the same version of a file, as far
+// as metadata tells.
+func sameFile(a, b File) bool {
+	if a.Symlink || b.Symlink {
+		return a.Symlink == b.Symlink && a.Target == b.Target
+	}
+	return a.Size == b.Size && a.ModTime == b.ModTime && a.Mode == b.Mode
+}
+
+// scanLocal lists the files under root that are not ignored, loading each
+// directory's .gitignore as it goes. It returns the snapshot along with
+// ignorer extended by those .gitignore files, for filtering the remote side.
+func scanLocal(root string, ignorer *Ignorer) (Snapshot, *Ignorer, error) {
+	ig := &Ignorer{rules: append([]ignoreRule(nil), ignorer.rules...)}
+	snapshot := make(Snapshot)
+
+	err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Removed while we were walking
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if rel != "." && (d.Name() == ".git" || ig.Ignored(rel, true)) {
+				return filepath.SkipDir
+			}
+			if data, err := os.ReadFile(filepath.Join(file, ".gitignore")); err == nil {
+				dir := rel
+				if dir == "." {
+					dir = ""
+				}
+				ig.AddGitignore(dir, string(data))
+			}
+			return nil
+		}
+		if ig.Ignored(rel, false) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		f := File{Size: info.Size(), ModTime: info.ModTime().Unix(), Mode: info.Mode().Perm()}
+		switch {
+		case info.Mode()&fs.ModeSymlink != 0:
+			f.Symlink = true
+			if f.Target, err = os.Readlink(file); err != nil {
+				return nil
+			}
+		case !info.Mode().IsRegular():
+			return nil
+		}
+		snapshot[rel] = f
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return snapshot, ig, nil
+}
+
+// remoteListCommand lists the files under the directory $1 in the format
+// parsed by parseRemoteList: type, size, mtime, mode, link target and path,
+// tab-separated and NUL-terminated.
+const remoteListCommand = `cd "$1" && find . -name .git -prune -o \( -type f -o -type l \) -printf '%y\t%s\t%T@\t%m\t%l\t%P\0'`
+
+// parseRemoteList parses the output of remoteListCommand, leaving out
+// ignored files.
+func parseRemoteList(output []byte, ignorer *Ignorer) (Snapshot, error) {
+	snapshot := make(Snapshot)
+	for _, record := range bytes.Split(output, []byte{0}) {
+		if len(record) == 0 {
+			continue
+		}
+		fields := strings.SplitN(string(record), "\t", 6)
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("unexpected file listing %q", record)
+		}
+
+		rel := fields[5]
+		if ignorer.Ignored(rel, false) {
+			continue
+		}
+
+		size, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected size in file listing %q", record)
+		}
+		seconds, _, _ := strings.Cut(fields[2], ".")
+		modTime, err := strconv.ParseInt(seconds, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected mtime in file listing %q", record)
+		}
+		mode, err := strconv.ParseUint(fields[3], 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected mode in file listing %q", record)
+		}
+
+		snapshot[rel] = File{
+			Symlink: fields[0] == "l",
+			Size:    size,
+			ModTime: modTime,
+			Mode:    fs.FileMode(mode).Perm(),
+			Target:  fields[4],
+		}
+	}
+	return snapshot, nil
+}
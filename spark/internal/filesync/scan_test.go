@@ -0,0 +1,83 @@
+package filesync
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRemoteList(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []string
+		ignore  []string
+		want    Snapshot
+		wantErr string
+	}{
+		{name: "empty", want: Snapshot{}},
+		{
+			name:    "regular file",
+			records: []string{"f\t12\t1700000000.0000000000\t644\t\tsrc/main.go"},
+			want:    Snapshot{"src/main.go": {Size: 12, ModTime: 1700000000, Mode: 0o644}},
+		},
+		{
+			name:    "fractional mtime truncated",
+			records: []string{"f\t0\t1700000000.9999999990\t755\t\trun.sh"},
+			want:    Snapshot{"run.sh": {ModTime: 1700000000, Mode: 0o755}},
+		},
+		{
+			name:    "whole second mtime",
+			records: []string{"f\t0\t1700000000\t600\t\tkey"},
+			want:    Snapshot{"key": {ModTime: 1700000000, Mode: 0o600}},
+		},
+		{
+			name:    "symlink",
+			records: []string{"l\t7\t1700000000.5\t777\t../a b\tlink"},
+			want:    Snapshot{"link": {Symlink: true, Size: 7, ModTime: 1700000000, Mode: 0o777, Target: "../a b"}},
+		},
+		{
+			name:    "mode keeps permission bits only",
+			records: []string{"f\t0\t1\t4755\t\tsetuid"},
+			want:    Snapshot{"setuid": {ModTime: 1, Mode: 0o755}},
+		},
+		{
+			name:    "tab in path",
+			records: []string{"f\t0\t1\t644\t\ta\tb"},
+			want:    Snapshot{"a\tb": {ModTime: 1, Mode: 0o644}},
+		},
+		{
+			name:    "ignored files skipped",
+			records: []string{"f\t0\t1\t644\t\tdebug.log", "f\t0\t1\t644\t\tbuild/out", "f\t0\t1\t644\t\tkeep"},
+			ignore:  []string{"*.log", "build/"},
+			want:    Snapshot{"keep": {ModTime: 1, Mode: 0o644}},
+		},
+		{
+			name:    "ignored malformed record skipped",
+			records: []string{"f\tx\t1\t644\t\tdebug.log"},
+			ignore:  []string{"*.log"},
+			want:    Snapshot{},
+		},
+		{name: "too few fields", records: []string{"f\t0\t1\t644"}, wantErr: "unexpected file listing"},
+		{name: "bad size", records: []string{"f\tx\t1\t644\t\ta"}, wantErr: "unexpected size"},
+		{name: "bad mtime", records: []string{"f\t0\tnow\t644\t\ta"}, wantErr: "unexpected mtime"},
+		{name: "bad mode", records: []string{"f\t0\t1\t9\t\ta"}, wantErr: "unexpected mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output := []byte(strings.Join(tt.records, "\x00") + "\x00")
+			got, err := parseRemoteList(output, NewIgnorer(tt.ignore))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseRemoteList() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRemoteList() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRemoteList() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
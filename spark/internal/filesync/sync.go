@@ -0,0 +1,481 @@
+// Package filesync keeps a local directory and a directory inside a spark in
+// sync in both directions.
+package filesync
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/t-eckert/homelab/spark/internal/archive"
+)
+
+// Runner runs a command on the remote side, streaming stdin to it and its
+// output to stdout. Either may be nil.
+type Runner func(ctx context.Context, command []string, stdin io.Reader, stdout io.Writer) error
+
+// Options configures a Syncer.
+type Options struct {
+	LocalDir  string
+	RemoteDir string
+	// Exclude holds extra patterns ignored in addition to .gitignore files,
+	// written as in a .gitignore at the sync root.
+	Exclude []string
+	// Interval is how often a side that can't be watched for changes is
+	// checked for them. Each check lists the whole remote directory, so
+	// short intervals are costly on large trees.
+	Interval time.Duration
+	// Log receives a line for every change synced.
+	Log func(format string, args ...any)
+}
+
+// pair is the state of a file on both sides when it was last in sync.
+type pair struct {
+	local, remote File
+}
+
+// Syncer syncs changes between a local and a remote directory. Changes are
+// detected by comparing each side against the state of the last sync, so a
+// file changed on only one side is copied to the other, and a file changed on
+// both is a conflict.
+type Syncer struct {
+	opts   Options
+	run    Runner
+	ignore *Ignorer
+	// scanned holds the ignore rules of the last scan, with the .gitignore
+	// files found.
+	scanned *Ignorer
+	synced  map[string]pair
+}
+
+// plan is the work found by a single pass.
+type plan struct {
+	renameLocal  map[string]string
+	renameRemote map[string]string
+	push         []string
+	pull         []string
+	deleteLocal  []string
+	deleteRemote []string
+	// inSync are paths already identical on both sides.
+	inSync []string
+}
+
+func (p *plan) empty() bool {
+	return len(p.renameLocal) == 0 && len(p.renameRemote) == 0 && len(p.push) == 0 &&
+		len(p.pull) == 0 && len(p.deleteLocal) == 0 && len(p.deleteRemote) == 0
+}
+
+// New returns a Syncer running remote commands with run.
+func New(run Runner, opts Options) *Syncer {
+	if opts.Log == nil {
+		opts.Log = func(string, ...any) {}
+	}
+	return &Syncer{
+		opts:   opts,
+		run:    run,
+		ignore: NewIgnorer(opts.Exclude),
+		synced: make(map[string]pair),
+	}
+}
+
+// Run reconciles both sides and then keeps syncing changes until ctx is
+// cancelled. Changes are watched for with fsnotify locally and inotifywait
+// in the spark; a side that can't be watched is checked every Interval
+// instead. Failures after the initial reconciliation, such as the spark's
+// pod restarting, are logged and retried.
+func (s *Syncer) Run(ctx context.Context) error {
+	err := s.run(ctx, []string{"mkdir", "-p", s.opts.RemoteDir}, nil, io.Discard)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", s.opts.RemoteDir, err)
+	}
+
+	// Start watching before the initial sync so no change is missed
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	remoteChanges := make(chan struct{}, 1)
+	remoteDone := make(chan error, 1)
+	go func() {
+		remoteDone <- s.watchRemote(ctx, func() {
+			select {
+			case remoteChanges <- struct{}{}:
+			default:
+			}
+		})
+	}()
+
+	var localEvents chan fsnotify.Event
+	var localErrors chan error
+	watcher, err := s.watchLocal()
+	if err != nil {
+		s.opts.Log("Can't watch %s for changes (%v), checking it every %s", s.opts.LocalDir, err, s.opts.Interval)
+	} else {
+		defer watcher.Close()
+		localEvents, localErrors = watcher.Events, watcher.Errors
+	}
+
+	if err := s.Sync(ctx); err != nil {
+		return err
+	}
+	s.opts.Log("Initial sync complete, watching for changes")
+
+	// poll stays nil, and never fires, while both sides are watched
+	var poll <-chan time.Time
+	var ticker *time.Ticker
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	startPolling := func() {
+		if ticker == nil {
+			ticker = time.NewTicker(s.opts.Interval)
+			poll = ticker.C
+		}
+	}
+	if watcher == nil {
+		startPolling()
+	}
+
+	var settled <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event := <-localEvents:
+			if s.localChange(watcher, event) && settled == nil {
+				settled = time.After(settleDelay)
+			}
+			continue
+		case err := <-localErrors:
+			if !localWatchError(err) {
+				s.opts.Log("Watching %s failed: %v", s.opts.LocalDir, err)
+			}
+			if settled == nil {
+				settled = time.After(settleDelay)
+			}
+			continue
+		case <-remoteChanges:
+			if settled == nil {
+				settled = time.After(settleDelay)
+			}
+			continue
+		case err := <-remoteDone:
+			if ctx.Err() != nil {
+				return nil
+			}
+			s.opts.Log("Can't watch the spark for changes (%v), checking it every %s", err, s.opts.Interval)
+			remoteDone = nil
+			startPolling()
+			continue
+		case <-settled:
+			settled = nil
+		case <-poll:
+		}
+
+		if err := s.Sync(ctx); err != nil && ctx.Err() == nil {
+			s.opts.Log("Sync failed, retrying: %v", err)
+		}
+	}
+}
+
+// Sync makes a single pass, copying changes made since the last one in both
+// directions.
+func (s *Syncer) Sync(ctx context.Context) error {
+	local, remote, err := s.scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	p, err := s.plan(ctx, local, remote)
+	if err != nil {
+		return err
+	}
+
+	for _, rel := range p.inSync {
+		s.synced[rel] = pair{local: local[rel], remote: remote[rel]}
+	}
+	if p.empty() {
+		return nil
+	}
+
+	applyErr := s.apply(ctx, p)
+
+	// Record the state the changes left behind rather than what was
+	// expected, since the two sides may differ in what they preserve
+	local, remote, err = s.scan(ctx)
+	if err != nil {
+		return err
+	}
+	for _, list := range [][]string{p.push, p.pull, p.deleteLocal, p.deleteRemote} {
+		for _, rel := range list {
+			l, lok := local[rel]
+			r, rok := remote[rel]
+			if lok && rok {
+				s.synced[rel] = pair{local: l, remote: r}
+			} else {
+				delete(s.synced, rel)
+			}
+		}
+	}
+
+	return applyErr
+}
+
+func (s *Syncer) scan(ctx context.Context) (Snapshot, Snapshot, error) {
+	local, ig, err := scanLocal(s.opts.LocalDir, s.ignore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan %s: %w", s.opts.LocalDir, err)
+	}
+	s.scanned = ig
+
+	var out bytes.Buffer
+	err = s.run(ctx, []string{"sh", "-c", remoteListCommand, "sh", s.opts.RemoteDir}, nil, &out)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to scan %s: %w", s.opts.RemoteDir, err)
+	}
+	remote, err := parseRemoteList(out.Bytes(), ig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return local, remote, nil
+}
+
+// plan decides what to do with every path seen on either side or in the last
+// sync.
+func (s *Syncer) plan(ctx context.Context, local, remote Snapshot) (*plan, error) {
+	p := &plan{renameLocal: map[string]string{}, renameRemote: map[string]string{}}
+
+	paths := make(map[string]bool)
+	for _, snapshot := range []Snapshot{local, remote} {
+		for rel := range snapshot {
+			paths[rel] = true
+		}
+	}
+	for rel := range s.synced {
+		paths[rel] = true
+	}
+
+	var unknown []string
+	for rel := range paths {
+		l, lok := local[rel]
+		r, rok := remote[rel]
+		last, synced := s.synced[rel]
+
+		if !synced {
+			switch {
+			case lok && !rok:
+				p.push = append(p.push, rel)
+			case !lok && rok:
+				p.pull = append(p.pull, rel)
+			case sameFile(l, r):
+				p.inSync = append(p.inSync, rel)
+			default:
+				// New on both sides, which is expected when first
+				// reconciling a copy; compare contents to tell
+				unknown = append(unknown, rel)
+			}
+			continue
+		}
+
+		localChanged := !lok || !sameFile(last.local, l)
+		remoteChanged := !rok || !sameFile(last.remote, r)
+		switch {
+		case !localChanged && !remoteChanged:
+		case !remoteChanged:
+			if lok {
+				p.push = append(p.push, rel)
+			} else {
+				p.deleteRemote = append(p.deleteRemote, rel)
+			}
+		case !localChanged:
+			if rok {
+				p.pull = append(p.pull, rel)
+			} else {
+				p.deleteLocal = append(p.deleteLocal, rel)
+			}
+		case !lok && !rok:
+			delete(s.synced, rel)
+		case !lok:
+			// A change on one side wins over a deletion on the other
+			p.pull = append(p.pull, rel)
+		case !rok:
+			p.push = append(p.push, rel)
+		case sameFile(l, r):
+			p.inSync = append(p.inSync, rel)
+		default:
+			s.conflict(p, rel, l, r)
+		}
+	}
+
+	if len(unknown) > 0 {
+		same, err := s.sameContents(ctx, unknown)
+		if err != nil {
+			return nil, err
+		}
+		for _, rel := range unknown {
+			if same[rel] {
+				p.inSync = append(p.inSync, rel)
+			} else {
+				s.conflict(p, rel, local[rel], remote[rel])
+			}
+		}
+	}
+
+	for _, list := range [][]string{p.push, p.pull, p.deleteLocal, p.deleteRemote, p.inSync} {
+		sort.Strings(list)
+	}
+	return p, nil
+}
+
+// conflict resolves a file changed on both sides: the newer version wins and
+// the other is kept beside it as a conflict copy, which is synced like any
+// new file.
+func (s *Syncer) conflict(p *plan, rel string, l, r File) {
+	copyPath := conflictPath(rel, time.Now())
+	if r.ModTime > l.ModTime {
+		p.renameLocal[rel] = copyPath
+		p.pull = append(p.pull, rel)
+		s.opts.Log("! conflict in %s: kept the spark's version, saved yours as %s", rel, copyPath)
+	} else {
+		p.renameRemote[rel] = copyPath
+		p.push = append(p.push, rel)
+		s.opts.Log("! conflict in %s: kept your version, saved the spark's as %s", rel, copyPath)
+	}
+}
+
+// conflictPath names the conflict copy of rel, keeping its extension so it
+// still opens with the right tool.
+func conflictPath(rel string, now time.Time) string {
+	ext := path.Ext(rel)
+	return fmt.Sprintf("%s.sync-conflict-%s%s", strings.TrimSuffix(rel, ext), now.Format("20060102-150405"), ext)
+}
+
+// sameContents reports which of paths have identical contents on both sides.
+func (s *Syncer) sameContents(ctx context.Context, paths []string) (map[string]bool, error) {
+	var out bytes.Buffer
+	err := s.run(ctx, []string{"sh", "-c", `cd "$1" && xargs -0 sha256sum --`, "sh", s.opts.RemoteDir}, nulList(paths), &out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash files in %s: %w", s.opts.RemoteDir, err)
+	}
+
+	remoteSums := make(map[string]string)
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		sum, rel, ok := strings.Cut(scanner.Text(), "  ")
+		if ok {
+			remoteSums[rel] = sum
+		}
+	}
+
+	same := make(map[string]bool)
+	for _, rel := range paths {
+		sum, err := hashFile(s.localPath(rel))
+		same[rel] = err == nil && sum == remoteSums[rel]
+	}
+	return same, nil
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// apply carries out a plan: conflict copies first, then deletions, then
+// copies in each direction as a single tar stream.
+func (s *Syncer) apply(ctx context.Context, p *plan) error {
+	for from, to := range p.renameLocal {
+		if err := os.Rename(s.localPath(from), s.localPath(to)); err != nil {
+			return err
+		}
+	}
+	for from, to := range p.renameRemote {
+		err := s.run(ctx, []string{"sh", "-c", `cd "$1" && mv -- "$2" "$3"`, "sh", s.opts.RemoteDir, from, to}, nil, io.Discard)
+		if err != nil {
+			return fmt.Errorf("failed to save conflict copy of %s: %w", from, err)
+		}
+	}
+
+	for _, rel := range p.deleteLocal {
+		s.opts.Log("✗ %s (deleted in spark)", rel)
+		err := os.Remove(s.localPath(rel))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if len(p.deleteRemote) > 0 {
+		for _, rel := range p.deleteRemote {
+			s.opts.Log("✗ %s (deleted locally)", rel)
+		}
+		err := s.run(ctx, []string{"sh", "-c", `cd "$1" && xargs -0 rm -f --`, "sh", s.opts.RemoteDir}, nulList(p.deleteRemote), io.Discard)
+		if err != nil {
+			return fmt.Errorf("failed to delete files in %s: %w", s.opts.RemoteDir, err)
+		}
+	}
+
+	if len(p.push) > 0 {
+		for _, rel := range p.push {
+			s.opts.Log("→ %s", rel)
+		}
+		reader, writer := io.Pipe()
+		go func() {
+			writer.CloseWithError(archive.WriteFiles(writer, s.opts.LocalDir, p.push))
+		}()
+		err := s.run(ctx, []string{"tar", "-x", "-p", "--warning=no-timestamp", "-C", s.opts.RemoteDir, "-f", "-"}, reader, io.Discard)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("failed to copy files to %s: %w", s.opts.RemoteDir, err)
+		}
+	}
+
+	if len(p.pull) > 0 {
+		for _, rel := range p.pull {
+			s.opts.Log("← %s", rel)
+		}
+		reader, writer := io.Pipe()
+		extracted := make(chan error, 1)
+		go func() {
+			err := archive.Extract(reader, s.opts.LocalDir, "")
+			_, _ = io.Copy(io.Discard, reader)
+			extracted <- err
+		}()
+		err := s.run(ctx, []string{"tar", "-c", "-f", "-", "-C", s.opts.RemoteDir, "--null", "-T", "-"}, nulList(p.pull), writer)
+		writer.CloseWithError(err)
+		if extractErr := <-extracted; err == nil && extractErr != nil {
+			err = extractErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to copy files from %s: %w", s.opts.RemoteDir, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *Syncer) localPath(rel string) string {
+	return filepath.Join(s.opts.LocalDir, filepath.FromSlash(rel))
+}
+
+func nulList(paths []string) io.Reader {
+	return strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+}
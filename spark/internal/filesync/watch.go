@@ -0,0 +1,116 @@
+package filesync
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// settleDelay is how long Run waits after a change before syncing, so a
+// burst of changes such as a checkout or a build is synced in one pass.
+const settleDelay = 300 * time.Millisecond
+
+// remoteWatchCommand prints a line for every change under the directory
+// given as its argument until it is stopped.
+const remoteWatchCommand = `if ! command -v inotifywait >/dev/null 2>&1; then
+    echo "inotifywait is not installed" >&2
+    exit 1
+fi
+exec inotifywait -m -r -q -e close_write,attrib,create,delete,move --exclude '/\.git(/|$)' --format '%w%f' "$1"`
+
+// watchRemote runs remoteWatchCommand, calling changed for everything it
+// prints. It returns when the command exits, which it only does on its own
+// if it fails.
+func (s *Syncer) watchRemote(ctx context.Context, changed func()) error {
+	return s.run(ctx, []string{"sh", "-c", remoteWatchCommand, "sh", s.opts.RemoteDir}, nil, signalWriter(changed))
+}
+
+// signalWriter calls itself for every write, discarding what is written.
+type signalWriter func()
+
+func (w signalWriter) Write(p []byte) (int, error) {
+	w()
+	return len(p), nil
+}
+
+// watchLocal returns a watcher for every directory of the local side that
+// isn't ignored.
+func (s *Syncer) watchLocal() (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.watchTree(watcher, s.opts.LocalDir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+// watchTree adds dir and the directories below it to watcher.
+func (s *Syncer) watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(s.opts.LocalDir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel != "." && (d.Name() == ".git" || s.ignorer().Ignored(rel, true)) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(file)
+	})
+}
+
+// localChange reports whether a local event may need syncing, watching
+// directories as they are created.
+func (s *Syncer) localChange(watcher *fsnotify.Watcher, event fsnotify.Event) bool {
+	rel, err := filepath.Rel(s.opts.LocalDir, event.Name)
+	if err != nil {
+		return true
+	}
+	rel = filepath.ToSlash(rel)
+	if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return false
+	}
+	if event.Has(fsnotify.Create) {
+		if info, err := os.Lstat(event.Name); err == nil && info.IsDir() {
+			// Files may have been created in it before it was watched
+			if err := s.watchTree(watcher, event.Name); err != nil {
+				s.opts.Log("Failed to watch %s: %v", rel, err)
+			}
+			return true
+		}
+	}
+	return !s.ignorer().Ignored(rel, false)
+}
+
+// ignorer returns the ignore rules of the last scan, which include the
+// .gitignore files found, or the configured ones before the first.
+func (s *Syncer) ignorer() *Ignorer {
+	if s.scanned != nil {
+		return s.scanned
+	}
+	return s.ignore
+}
+
+// localWatchError reports whether a watcher error lost events, so a sync
+// is needed to catch up, rather than the watcher failing.
+func localWatchError(err error) bool {
+	return errors.Is(err, fsnotify.ErrEventOverflow)
+}
@@ -0,0 +1,84 @@
+package k8s
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// addon is a service run as a sidecar container next to a spark's
+// environment, reachable on localhost.
+type addon struct {
+	image string
+	args  []string
+	ports []int32
+	// env is added to the spark's environment to point clients at the
+	// service.
+	env map[string]string
+}
+
+var addons = map[string]addon{
+	"redis": {
+		image: "redis:7-alpine",
+		ports: []int32{6379},
+		env:   map[string]string{"REDIS_URL": "redis://localhost:6379"},
+	},
+	"mailpit": {
+		image: "axllent/mailpit:latest",
+		ports: []int32{1025, 8025},
+		env:   map[string]string{"SMTP_URL": "smtp://localhost:1025"},
+	},
+}
+
+// Addons returns the names of the available add-ons.
+func Addons() []string {
+	names := make([]string, 0, len(addons))
+	for name := range addons {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func validateAddons(names []string) error {
+	for _, name := range names {
+		if _, ok := addons[name]; !ok {
+			return fmt.Errorf("unknown add-on %q (available: %s)", name, strings.Join(Addons(), ", "))
+		}
+	}
+	return nil
+}
+
+// addonContainers returns the sidecar containers of the spark's add-ons.
+func (s *SparkResources) addonContainers() []corev1.Container {
+	var containers []corev1.Container
+	for _, name := range s.Addons {
+		a := addons[name]
+		container := corev1.Container{
+			Name:  name,
+			Image: a.image,
+			Args:  a.args,
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("10m"),
+					corev1.ResourceMemory: resource.MustParse("32Mi"),
+				},
+				Limits: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse("250m"),
+					corev1.ResourceMemory: resource.MustParse("256Mi"),
+				},
+			},
+		}
+		for _, port := range a.ports {
+			container.Ports = append(container.Ports, corev1.ContainerPort{
+				ContainerPort: port,
+				Protocol:      corev1.ProtocolTCP,
+			})
+		}
+		containers = append(containers, container)
+	}
+	return containers
+}
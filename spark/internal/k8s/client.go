@@ -3,17 +3,24 @@ package k8s
 import (
 	"context"
 	"fmt"
+	"strings"
 
+	"github.com/t-eckert/homelab/spark/internal/names"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
 // Client is a Kubernetes client for managing spark resources.
 type Client struct {
 	clientset *kubernetes.Clientset
+	dynamic   dynamic.Interface
+	config    *rest.Config
 }
 
 // NewClient creates a new Kubernetes client.
@@ -32,13 +39,36 @@ func NewClient() (*Client, error) {
 		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 
-	return &Client{clientset: clientset}, nil
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	return &Client{clientset: clientset, dynamic: dynamicClient, config: config}, nil
 }
 
 // CreateSpark creates all Kubernetes resources for a new spark.
 func (c *Client) CreateSpark(ctx context.Context, resources *SparkResources) error {
+	if err := names.Validate(resources.Name); err != nil {
+		return err
+	}
+
+	// Render the Deployment first so a bad template fails before anything
+	// is created
+	deployment, err := resources.CreateDeployment()
+	if err != nil {
+		return err
+	}
+
+	if err := c.checkSecretRefs(ctx, resources.SecretEnv); err != nil {
+		return err
+	}
+	if err := c.checkCapacity(ctx, deployment.Spec.Template.Spec.Containers); err != nil {
+		return err
+	}
+
 	// Create ConfigMap
-	_, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).Create(ctx, resources.CreateConfigMap(), metav1.CreateOptions{})
+	_, err = c.clientset.CoreV1().ConfigMaps(SparkNamespace).Create(ctx, resources.CreateConfigMap(), metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create configmap: %w", err)
 	}
@@ -48,6 +78,10 @@ func (c *Client) CreateSpark(ctx context.Context, resources *SparkResources) err
 	if err != nil {
 		return fmt.Errorf("failed to create secret: %w", err)
 	}
+	_, err = c.clientset.CoreV1().Secrets(SparkNamespace).Create(ctx, resources.CreateEnvSecret(), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create env secret: %w", err)
+	}
 
 	// Create PVC
 	_, err = c.clientset.CoreV1().PersistentVolumeClaims(SparkNamespace).Create(ctx, resources.CreatePVC(), metav1.CreateOptions{})
@@ -62,7 +96,7 @@ func (c *Client) CreateSpark(ctx context.Context, resources *SparkResources) err
 	}
 
 	// Create Deployment
-	_, err = c.clientset.AppsV1().Deployments(SparkNamespace).Create(ctx, resources.CreateDeployment(), metav1.CreateOptions{})
+	_, err = c.clientset.AppsV1().Deployments(SparkNamespace).Create(ctx, deployment, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create deployment: %w", err)
 	}
@@ -97,6 +131,18 @@ func (c *Client) DeleteSpark(ctx context.Context, name string) error {
 		return fmt.Errorf("failed to delete deployment: %w", err)
 	}
 
+	// Delete exposed ports
+	exposures, err := c.ListExposures(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, exposure := range exposures {
+		err = c.Unexpose(ctx, name, exposure.Port)
+		if err != nil {
+			return fmt.Errorf("failed to unexpose port %d: %w", exposure.Port, err)
+		}
+	}
+
 	// Delete service
 	err = c.clientset.CoreV1().Services(SparkNamespace).Delete(ctx, name+"-ssh", metav1.DeleteOptions{})
 	if err != nil {
@@ -114,6 +160,11 @@ func (c *Client) DeleteSpark(ctx context.Context, name string) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete secret: %w", err)
 	}
+	// Sparks created before spark env have no env Secret
+	err = c.clientset.CoreV1().Secrets(SparkNamespace).Delete(ctx, envSecretName(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete env secret: %w", err)
+	}
 
 	// Delete ConfigMap
 	err = c.clientset.CoreV1().ConfigMaps(SparkNamespace).Delete(ctx, name+"-config", metav1.DeleteOptions{})
@@ -151,3 +202,54 @@ func (c *Client) GetSparkPod(ctx context.Context, name string) (*corev1.Pod, err
 func (c *Client) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
 	return c.clientset.AppsV1().Deployments(SparkNamespace).Get(ctx, name, metav1.GetOptions{})
 }
+
+// GetHostPublicKey returns the spark's pinned SSH host public key, or an empty
+// string for sparks created before host keys were persisted.
+func (c *Client) GetHostPublicKey(ctx context.Context, name string) (string, error) {
+	secret, err := c.clientset.CoreV1().Secrets(SparkNamespace).Get(ctx, name+"-secret", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret: %w", err)
+	}
+	return string(secret.Data[HostPublicKeySecretKey]), nil
+}
+
+// GetSSHHostname returns the tailnet hostname of the spark's SSH Service as
+// reported by the Tailscale operator, falling back to the short MagicDNS name
+// until the operator has provisioned the device.
+func (c *Client) GetSSHHostname(ctx context.Context, name string) (string, error) {
+	service, err := c.clientset.CoreV1().Services(SparkNamespace).Get(ctx, name+"-ssh", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get service: %w", err)
+	}
+	if ingress := service.Status.LoadBalancer.Ingress; len(ingress) > 0 && ingress[0].Hostname != "" {
+		return ingress[0].Hostname, nil
+	}
+	return TailscaleHostname(name), nil
+}
+
+// GetProjectDir returns the directory of the spark's first git repository,
+// or an empty string if it was created without one.
+func (c *Client) GetProjectDir(ctx context.Context, name string) (string, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).Get(ctx, name+"-config", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get configmap: %w", err)
+	}
+	if dir, ok := configMap.Data["project_dir"]; ok {
+		return dir, nil
+	}
+	// Sparks created before multiple repositories record only the URL
+	if configMap.Data["git_repo"] != "" {
+		return ProjectDir, nil
+	}
+	return "", nil
+}
+
+// GetForwardPorts returns the ports the spark's repository asks to forward,
+// from its devcontainer.json.
+func (c *Client) GetForwardPorts(ctx context.Context, name string) ([]string, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).Get(ctx, name+"-config", metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configmap: %w", err)
+	}
+	return strings.Fields(configMap.Data["forward_ports"]), nil
+}
@@ -0,0 +1,341 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReservedEnv are the variables spark sets itself, which can't be
+// overridden.
+var ReservedEnv = []string{"DATABASE_URL", "ANTHROPIC_API_KEY", "SPARK_NAME"}
+
+// SecretRef is a key of an existing Secret in the spark namespace.
+type SecretRef struct {
+	Secret string
+	Key    string
+}
+
+// ParseSecretRef parses a secret reference of the form secretName/key.
+func ParseSecretRef(s string) (SecretRef, error) {
+	secret, key, ok := strings.Cut(s, "/")
+	if !ok || secret == "" || key == "" || strings.Contains(key, "/") {
+		return SecretRef{}, fmt.Errorf("invalid secret reference %q, expected secretName/key", s)
+	}
+	return SecretRef{Secret: secret, Key: key}, nil
+}
+
+func (r SecretRef) String() string {
+	return r.Secret + "/" + r.Key
+}
+
+// ValidateEnvName checks that name can be set on a spark.
+func ValidateEnvName(name string) error {
+	if !envNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid environment variable name %q", name)
+	}
+	for _, reserved := range ReservedEnv {
+		if name == reserved {
+			return fmt.Errorf("%s is set by spark and can't be changed", name)
+		}
+	}
+	return nil
+}
+
+// envSecretName returns the name of the Secret holding a spark's variables.
+func envSecretName(name string) string {
+	return name + "-env"
+}
+
+// envMountPath is where the spark's env Secret is mounted, so the init
+// script can tell which variables came from it.
+const envMountPath = "/tmp/spark-env"
+
+// installEnvScript writes the spark's variables to a profile script for
+// login shells and, along with those spark sets itself, to the environment
+// file sshd reads for SSH sessions. The variables named as arguments are
+// read from the env Secret's files, as a variable the container also sets
+// from the template hides the Secret's value in its environment, and the
+// others from the script's environment. Further export lines are read from
+// stdin. Values spanning several lines can't be represented in the sshd
+// file and are left out of it.
+const installEnvScript = `set -e
+profile=/etc/profile.d/spark-user-env.sh
+{
+    for name in "$@"; do
+        if [ -f "` + envMountPath + `/$name" ]; then
+            value=$(cat "` + envMountPath + `/$name")
+        else
+            value=$(printenv "$name") || continue
+        fi
+        printf "export %s='%s'\n" "$name" "$(printf '%s' "$value" | sed "s/'/'\\\\''/g")"
+    done
+    cat
+} > "$profile.tmp"
+mv "$profile.tmp" "$profile"
+
+mkdir -p /home/user/.ssh
+(
+    . "$profile"
+    for name in DATABASE_URL ANTHROPIC_API_KEY SPARK_NAME $(sed -n 's/^export \([A-Za-z_][A-Za-z0-9_]*\)=.*/\1/p' "$profile"); do
+        value=$(printenv "$name") || continue
+        case "$value" in
+        *"
+"*) continue ;;
+        esac
+        printf '%s=%s\n' "$name" "$value"
+    done
+) > /home/user/.ssh/environment.tmp
+chmod 600 /home/user/.ssh/environment.tmp
+chown 1000:1000 /home/user/.ssh /home/user/.ssh/environment.tmp
+mv /home/user/.ssh/environment.tmp /home/user/.ssh/environment`
+
+// CreateEnvSecret creates the Secret holding the spark's variables.
+func (s *SparkResources) CreateEnvSecret() *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      envSecretName(s.Name),
+			Namespace: SparkNamespace,
+			Labels: map[string]string{
+				"app":        "spark",
+				"spark-name": s.Name,
+			},
+		},
+		StringData: s.UserEnv,
+	}
+}
+
+// secretEnvVars returns the container variables referencing other Secrets.
+func secretEnvVars(refs map[string]SecretRef) []corev1.EnvVar {
+	env := make([]corev1.EnvVar, 0, len(refs))
+	for name, ref := range refs {
+		env = append(env, corev1.EnvVar{
+			Name: name,
+			ValueFrom: &corev1.EnvVarSource{
+				SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: ref.Secret},
+					Key:                  ref.Key,
+				},
+			},
+		})
+	}
+	sort.Slice(env, func(i, j int) bool {
+		return env[i].Name < env[j].Name
+	})
+	return env
+}
+
+// checkSecretRefs verifies that the referenced Secrets and keys exist, since
+// the spark's pod can't start otherwise.
+func (c *Client) checkSecretRefs(ctx context.Context, refs map[string]SecretRef) error {
+	for name, ref := range refs {
+		secret, err := c.clientset.CoreV1().Secrets(SparkNamespace).Get(ctx, ref.Secret, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("%s references secret %s: %w", name, ref.Secret, err)
+		}
+		if _, ok := secret.Data[ref.Key]; !ok {
+			return fmt.Errorf("%s references key %s, which secret %s doesn't have", name, ref.Key, ref.Secret)
+		}
+	}
+	return nil
+}
+
+// GetEnv returns the spark's variables and the variables referencing other
+// Secrets.
+func (c *Client) GetEnv(ctx context.Context, name string) (map[string]string, map[string]SecretRef, error) {
+	deployment, err := c.GetDeployment(ctx, name)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get deployment: %w", err)
+	}
+	container := sparkContainer(deployment.Spec.Template.Spec.Containers)
+	if container == nil {
+		return nil, nil, fmt.Errorf("deployment %s has no %s container", name, SparkContainer)
+	}
+
+	values := make(map[string]string)
+	secret, err := c.clientset.CoreV1().Secrets(SparkNamespace).Get(ctx, envSecretName(name), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, nil, fmt.Errorf("failed to get env secret: %w", err)
+	}
+	if err == nil {
+		for k, v := range secret.Data {
+			values[k] = string(v)
+		}
+	}
+
+	refs := make(map[string]SecretRef)
+	for _, env := range container.Env {
+		if env.ValueFrom == nil || env.ValueFrom.SecretKeyRef == nil {
+			continue
+		}
+		ref := env.ValueFrom.SecretKeyRef
+		if ref.Name == name+"-secret" {
+			continue
+		}
+		refs[env.Name] = SecretRef{Secret: ref.Name, Key: ref.Key}
+	}
+	return values, refs, nil
+}
+
+// EnvApplied is how a change to a spark's environment took effect.
+type EnvApplied int
+
+const (
+	// EnvPending changes apply when the spark next starts.
+	EnvPending EnvApplied = iota
+	// EnvLive changes were written to the running pod.
+	EnvLive
+	// EnvRestarting changes updated the Deployment, restarting the spark.
+	EnvRestarting
+)
+
+// SetEnv replaces the spark's variables and secret references. Values are
+// kept in the spark's env Secret. Changing the references, or creating the
+// env Secret of a spark that predates it, updates the Deployment, which
+// restarts the spark; otherwise the files in the running pod are rewritten
+// so new shells see the values without a restart.
+func (c *Client) SetEnv(ctx context.Context, name string, values map[string]string, refs map[string]SecretRef) (EnvApplied, error) {
+	_, currentRefs, err := c.GetEnv(ctx, name)
+	if err != nil {
+		return EnvPending, err
+	}
+	if err := c.checkSecretRefs(ctx, refs); err != nil {
+		return EnvPending, err
+	}
+
+	secrets := c.clientset.CoreV1().Secrets(SparkNamespace)
+	secret, err := secrets.Get(ctx, envSecretName(name), metav1.GetOptions{})
+	attach := false
+	if apierrors.IsNotFound(err) {
+		// Sparks created before spark env have no env Secret, and their
+		// Deployment doesn't use one
+		_, err = secrets.Create(ctx, (&SparkResources{Name: name, UserEnv: values}).CreateEnvSecret(), metav1.CreateOptions{})
+		if err != nil {
+			return EnvPending, fmt.Errorf("failed to create env secret: %w", err)
+		}
+		attach = true
+	} else if err != nil {
+		return EnvPending, fmt.Errorf("failed to get env secret: %w", err)
+	} else {
+		secret.Data = nil
+		secret.StringData = values
+		if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+			return EnvPending, fmt.Errorf("failed to update env secret: %w", err)
+		}
+	}
+
+	if attach || !sameRefs(refs, currentRefs) {
+		if err := c.setSecretEnv(ctx, name, refs, attach); err != nil {
+			return EnvPending, err
+		}
+		return EnvRestarting, nil
+	}
+
+	if _, err := c.GetSparkPod(ctx, name); err != nil {
+		return EnvPending, nil
+	}
+	var profile strings.Builder
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(&profile, "export %s=%s\n", k, shellQuote(values[k]))
+	}
+	err = c.Exec(ctx, name, ExecOptions{
+		Command: append([]string{"sh", "-c", installEnvScript, "spark-env"}, sortedKeys(refs)...),
+		Stdin:   strings.NewReader(profile.String()),
+		Stdout:  io.Discard,
+		Stderr:  io.Discard,
+	})
+	if err != nil {
+		return EnvPending, fmt.Errorf("failed to update the environment in the running pod: %w", err)
+	}
+	return EnvLive, nil
+}
+
+// setSecretEnv replaces the spark container's secret references, and
+// attaches the env Secret to it if attach is set.
+func (c *Client) setSecretEnv(ctx context.Context, name string, refs map[string]SecretRef, attach bool) error {
+	deployment, err := c.GetDeployment(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	container := sparkContainer(deployment.Spec.Template.Spec.Containers)
+	if container == nil {
+		return fmt.Errorf("deployment %s has no %s container", name, SparkContainer)
+	}
+
+	var env []corev1.EnvVar
+	for _, e := range container.Env {
+		if e.ValueFrom != nil && e.ValueFrom.SecretKeyRef != nil && e.ValueFrom.SecretKeyRef.Name != name+"-secret" {
+			continue
+		}
+		env = append(env, e)
+	}
+	container.Env = append(env, secretEnvVars(refs)...)
+	if attach {
+		attachEnvSecret(&deployment.Spec.Template.Spec, container, name)
+	}
+
+	_, err = c.clientset.AppsV1().Deployments(SparkNamespace).Update(ctx, deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+	return nil
+}
+
+// attachEnvSecret adds the spark's env Secret to the container's
+// environment and mounts it where the init script reads it, as
+// CreateDeployment does.
+func attachEnvSecret(pod *corev1.PodSpec, container *corev1.Container, name string) {
+	container.EnvFrom = append(container.EnvFrom, corev1.EnvFromSource{
+		SecretRef: &corev1.SecretEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: envSecretName(name)},
+		},
+	})
+	container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+		Name:      "spark-env",
+		MountPath: envMountPath,
+		ReadOnly:  true,
+	})
+	pod.Volumes = append(pod.Volumes, corev1.Volume{
+		Name: "spark-env",
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: envSecretName(name)},
+		},
+	})
+}
+
+func sameRefs(a, b map[string]SecretRef) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, ref := range a {
+		if other, ok := b[name]; !ok || other != ref {
+			return false
+		}
+	}
+	return true
+}
+
+// sparkContainer returns the container running the spark's environment.
+func sparkContainer(containers []corev1.Container) *corev1.Container {
+	for i := range containers {
+		if containers[i].Name == SparkContainer {
+			return &containers[i]
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
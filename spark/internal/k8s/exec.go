@@ -0,0 +1,80 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+)
+
+// SparkContainer is the name of the container running a spark's environment.
+const SparkContainer = "debian"
+
+// ExecOptions configures a command run in a spark's container.
+type ExecOptions struct {
+	Command []string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+	// TTY allocates a terminal for the command. Stderr is merged into
+	// Stdout when it is set.
+	TTY bool
+	// SizeQueue reports terminal size changes when TTY is set.
+	SizeQueue remotecommand.TerminalSizeQueue
+}
+
+// Exec runs a command in the spark's running pod through the Kubernetes exec
+// API, streaming its input and output until it exits.
+func (c *Client) Exec(ctx context.Context, name string, opts ExecOptions) error {
+	pod, err := c.GetSparkPod(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(SparkNamespace).
+		SubResource("exec").
+		VersionedParams(&corev1.PodExecOptions{
+			Container: SparkContainer,
+			Command:   opts.Command,
+			Stdin:     opts.Stdin != nil,
+			Stdout:    opts.Stdout != nil,
+			Stderr:    opts.Stderr != nil && !opts.TTY,
+			TTY:       opts.TTY,
+		}, scheme.ParameterCodec)
+
+	// Prefer WebSockets and fall back to SPDY for older API servers, as
+	// kubectl does
+	websocketExec, err := remotecommand.NewWebSocketExecutor(c.config, "GET", req.URL().String())
+	if err != nil {
+		return fmt.Errorf("failed to create exec client: %w", err)
+	}
+	spdyExec, err := remotecommand.NewSPDYExecutor(c.config, "POST", req.URL())
+	if err != nil {
+		return fmt.Errorf("failed to create exec client: %w", err)
+	}
+	executor, err := remotecommand.NewFallbackExecutor(websocketExec, spdyExec, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec client: %w", err)
+	}
+
+	streamOpts := remotecommand.StreamOptions{
+		Stdin:             opts.Stdin,
+		Stdout:            opts.Stdout,
+		Tty:               opts.TTY,
+		TerminalSizeQueue: opts.SizeQueue,
+	}
+	if !opts.TTY {
+		streamOpts.Stderr = opts.Stderr
+	}
+
+	return executor.StreamWithContext(ctx, streamOpts)
+}
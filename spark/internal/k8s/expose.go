@@ -0,0 +1,298 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Labels and annotations recording how a spark port is exposed.
+const (
+	exposePortLabel     = "spark-expose-port"
+	exposeHostnameAnnot = "spark-expose-hostname"
+	exposeFunnelAnnot   = "spark-expose-funnel"
+	exposeIngressAnnot  = "spark-expose-ingress"
+	exposeURLAnnot      = "spark-expose-url"
+	exposeAuthAnnot     = "spark-expose-basic-auth"
+)
+
+// Tailscale operator configuration.
+const (
+	tailscaleHostnameAnnot = "tailscale.com/hostname"
+	tailscaleFunnelAnnot   = "tailscale.com/funnel"
+	tailscaleClass         = "tailscale"
+)
+
+// Exposure is a spark port reachable on the tailnet, publicly through
+// Tailscale Funnel, or through a Traefik IngressRoute.
+type Exposure struct {
+	Port     int32
+	Hostname string
+	Funnel   bool
+	Ingress  bool
+	// BasicAuth is whether an ingress exposure requires a password.
+	BasicAuth bool
+	// URL is empty until the Tailscale operator has provisioned the device.
+	URL string
+}
+
+// ExposeOptions configures how a spark port is exposed.
+type ExposeOptions struct {
+	// Hostname is the tailnet device name, or the full host routed to the
+	// port for Ingress.
+	Hostname string
+	// Funnel publishes the port through Tailscale Funnel.
+	Funnel bool
+	// Ingress routes Hostname to the port through Traefik on EntryPoint.
+	Ingress    bool
+	EntryPoint string
+	// BasicAuth protects an Ingress exposure with a password.
+	BasicAuth *BasicAuth
+}
+
+// ExposeHostname returns the default tailnet hostname for an exposed port.
+func ExposeHostname(name string, port int32) string {
+	return fmt.Sprintf("%s-%d", TailscaleHostname(name), port)
+}
+
+func exposeObjectName(name string, port int32) string {
+	return fmt.Sprintf("%s-port-%d", name, port)
+}
+
+func exposeLabels(name string, port int32) map[string]string {
+	return map[string]string{
+		"app":           "spark",
+		"spark-name":    name,
+		exposePortLabel: strconv.Itoa(int(port)),
+	}
+}
+
+// CreateExposeService creates the Service exposing a spark port. By default
+// it is a Tailscale LoadBalancer reachable on the tailnet. With Funnel it is a
+// ClusterIP Service backing a Tailscale Ingress, since the operator only
+// supports Funnel on Ingresses, and with Ingress one backing a Traefik
+// IngressRoute.
+func CreateExposeService(name string, port int32, opts ExposeOptions) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exposeObjectName(name, port),
+			Namespace: SparkNamespace,
+			Labels:    exposeLabels(name, port),
+			Annotations: map[string]string{
+				exposeHostnameAnnot: opts.Hostname,
+			},
+		},
+		Spec: corev1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP,
+			Ports: []corev1.ServicePort{
+				{
+					Name:       "http",
+					Port:       port,
+					TargetPort: intstr.FromInt32(port),
+					Protocol:   corev1.ProtocolTCP,
+				},
+			},
+			Selector: map[string]string{
+				"app":        "spark",
+				"spark-name": name,
+			},
+		},
+	}
+
+	switch {
+	case opts.Ingress:
+		service.Annotations[exposeIngressAnnot] = "true"
+		service.Annotations[exposeURLAnnot] = IngressURL(opts.Hostname, opts.EntryPoint)
+		if opts.BasicAuth != nil {
+			service.Annotations[exposeAuthAnnot] = "true"
+		}
+	case opts.Funnel:
+		service.Annotations[exposeFunnelAnnot] = "true"
+	default:
+		service.Annotations[tailscaleHostnameAnnot] = opts.Hostname
+		service.Spec.Type = corev1.ServiceTypeLoadBalancer
+		service.Spec.LoadBalancerClass = stringPtr(tailscaleClass)
+	}
+
+	return service
+}
+
+// CreateExposeIngress creates the Tailscale Ingress that publishes a spark
+// port through Funnel.
+func CreateExposeIngress(name string, port int32, hostname string) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      exposeObjectName(name, port),
+			Namespace: SparkNamespace,
+			Labels:    exposeLabels(name, port),
+			Annotations: map[string]string{
+				tailscaleFunnelAnnot: "true",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: stringPtr(tailscaleClass),
+			TLS: []networkingv1.IngressTLS{
+				{Hosts: []string{hostname}},
+			},
+			Rules: []networkingv1.IngressRule{
+				{
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: []networkingv1.HTTPIngressPath{
+								{
+									Path:     "/",
+									PathType: &pathType,
+									Backend: networkingv1.IngressBackend{
+										Service: &networkingv1.IngressServiceBackend{
+											Name: exposeObjectName(name, port),
+											Port: networkingv1.ServiceBackendPort{Number: port},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Expose makes a spark port reachable as described by opts, replacing any
+// existing exposure of the same port.
+func (c *Client) Expose(ctx context.Context, name string, port int32, opts ExposeOptions) error {
+	if _, err := c.GetDeployment(ctx, name); err != nil {
+		return fmt.Errorf("spark %s not found: %w", name, err)
+	}
+
+	exposures, err := c.ListExposures(ctx, name)
+	if err != nil {
+		return err
+	}
+	for _, exposure := range exposures {
+		if exposure.Port != port && exposure.Hostname == opts.Hostname {
+			return fmt.Errorf("hostname %s is already used by port %d", opts.Hostname, exposure.Port)
+		}
+	}
+
+	// Replace rather than update, since changing how the port is exposed
+	// changes the Service type and which other objects exist
+	if err := c.Unexpose(ctx, name, port); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, err = c.clientset.CoreV1().Services(SparkNamespace).Create(ctx, CreateExposeService(name, port, opts), metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+
+	switch {
+	case opts.Ingress:
+		return c.createIngressRoute(ctx, name, port, opts)
+	case opts.Funnel:
+		_, err = c.clientset.NetworkingV1().Ingresses(SparkNamespace).Create(ctx, CreateExposeIngress(name, port, opts.Hostname), metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create ingress: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Unexpose removes the exposure of a spark port. It returns a NotFound error
+// if the port is not exposed.
+func (c *Client) Unexpose(ctx context.Context, name string, port int32) error {
+	objectName := exposeObjectName(name, port)
+
+	err := c.clientset.NetworkingV1().Ingresses(SparkNamespace).Delete(ctx, objectName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ingress: %w", err)
+	}
+
+	if err := c.deleteIngressRoute(ctx, name, port); err != nil {
+		return err
+	}
+
+	err = c.clientset.CoreV1().Services(SparkNamespace).Delete(ctx, objectName, metav1.DeleteOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return err
+		}
+		return fmt.Errorf("failed to delete service: %w", err)
+	}
+
+	return nil
+}
+
+// ListExposures returns the exposed ports of a spark, ordered by port.
+func (c *Client) ListExposures(ctx context.Context, name string) ([]Exposure, error) {
+	selector := fmt.Sprintf("app=spark,spark-name=%s,%s", name, exposePortLabel)
+
+	services, err := c.clientset.CoreV1().Services(SparkNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+
+	ingresses, err := c.clientset.NetworkingV1().Ingresses(SparkNamespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	ingressByName := make(map[string]networkingv1.Ingress, len(ingresses.Items))
+	for _, ingress := range ingresses.Items {
+		ingressByName[ingress.Name] = ingress
+	}
+
+	var exposures []Exposure
+	for _, service := range services.Items {
+		if len(service.Spec.Ports) == 0 {
+			continue
+		}
+		port := service.Spec.Ports[0].Port
+		exposure := Exposure{
+			Port:      port,
+			Hostname:  service.Annotations[exposeHostnameAnnot],
+			Funnel:    service.Annotations[exposeFunnelAnnot] == "true",
+			Ingress:   service.Annotations[exposeIngressAnnot] == "true",
+			BasicAuth: service.Annotations[exposeAuthAnnot] == "true",
+		}
+
+		switch {
+		case exposure.Ingress:
+			// Traefik routes the host as soon as the IngressRoute exists
+			exposure.URL = service.Annotations[exposeURLAnnot]
+		case exposure.Funnel:
+			if ingress, ok := ingressByName[service.Name]; ok {
+				if host := loadBalancerHostname(ingress.Status.LoadBalancer.Ingress); host != "" {
+					exposure.URL = "https://" + host
+				}
+			}
+		default:
+			if ingress := service.Status.LoadBalancer.Ingress; len(ingress) > 0 && ingress[0].Hostname != "" {
+				exposure.URL = fmt.Sprintf("http://%s:%d", ingress[0].Hostname, port)
+			}
+		}
+
+		exposures = append(exposures, exposure)
+	}
+
+	sort.Slice(exposures, func(i, j int) bool {
+		return exposures[i].Port < exposures[j].Port
+	})
+
+	return exposures, nil
+}
+
+func loadBalancerHostname(ingress []networkingv1.IngressLoadBalancerIngress) string {
+	if len(ingress) == 0 {
+		return ""
+	}
+	return ingress[0].Hostname
+}
@@ -0,0 +1,126 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Object identifies a single Kubernetes object belonging to a spark.
+type Object struct {
+	Kind      string
+	Name      string
+	SparkName string
+}
+
+// sparkObjectSelector matches objects created for an individual spark. Shared
+// objects such as the tools PVC carry app=spark but no spark-name label.
+const sparkObjectSelector = "app=spark,spark-name"
+
+// ListOrphanedObjects returns spark-labeled objects whose spark no longer has
+// a Deployment, such as those left behind by failed creates or partial
+// deletes.
+func (c *Client) ListOrphanedObjects(ctx context.Context) ([]Object, error) {
+	sparks, err := c.ListSparks(ctx)
+	if err != nil {
+		return nil, err
+	}
+	active := make(map[string]bool, len(sparks))
+	for _, name := range sparks {
+		active[name] = true
+	}
+
+	listOptions := metav1.ListOptions{LabelSelector: sparkObjectSelector}
+	var objects []Object
+
+	services, err := c.clientset.CoreV1().Services(SparkNamespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	for _, item := range services.Items {
+		objects = append(objects, Object{Kind: "Service", Name: item.Name, SparkName: item.Labels["spark-name"]})
+	}
+
+	pvcs, err := c.clientset.CoreV1().PersistentVolumeClaims(SparkNamespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pvcs: %w", err)
+	}
+	for _, item := range pvcs.Items {
+		objects = append(objects, Object{Kind: "PersistentVolumeClaim", Name: item.Name, SparkName: item.Labels["spark-name"]})
+	}
+
+	secrets, err := c.clientset.CoreV1().Secrets(SparkNamespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	for _, item := range secrets.Items {
+		objects = append(objects, Object{Kind: "Secret", Name: item.Name, SparkName: item.Labels["spark-name"]})
+	}
+
+	configMaps, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list configmaps: %w", err)
+	}
+	for _, item := range configMaps.Items {
+		objects = append(objects, Object{Kind: "ConfigMap", Name: item.Name, SparkName: item.Labels["spark-name"]})
+	}
+
+	ingresses, err := c.clientset.NetworkingV1().Ingresses(SparkNamespace).List(ctx, listOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	for _, item := range ingresses.Items {
+		objects = append(objects, Object{Kind: "Ingress", Name: item.Name, SparkName: item.Labels["spark-name"]})
+	}
+
+	// Traefik objects are listed through the dynamic client, and are absent
+	// rather than an error on clusters without the Traefik CRDs
+	for kind, resource := range traefikResources {
+		list, err := c.dynamic.Resource(resource).Namespace(SparkNamespace).List(ctx, listOptions)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", resource.Resource, err)
+		}
+		for _, item := range list.Items {
+			objects = append(objects, Object{Kind: kind, Name: item.GetName(), SparkName: item.GetLabels()["spark-name"]})
+		}
+	}
+
+	var orphans []Object
+	for _, obj := range objects {
+		if !active[obj.SparkName] {
+			orphans = append(orphans, obj)
+		}
+	}
+
+	return orphans, nil
+}
+
+// DeleteObject deletes a single spark object returned by ListOrphanedObjects.
+func (c *Client) DeleteObject(ctx context.Context, obj Object) error {
+	var err error
+	switch obj.Kind {
+	case "Service":
+		err = c.clientset.CoreV1().Services(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	case "PersistentVolumeClaim":
+		err = c.clientset.CoreV1().PersistentVolumeClaims(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	case "Secret":
+		err = c.clientset.CoreV1().Secrets(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	case "Ingress":
+		err = c.clientset.NetworkingV1().Ingresses(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	case "ConfigMap":
+		err = c.clientset.CoreV1().ConfigMaps(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	case "IngressRoute", "Middleware":
+		err = c.dynamic.Resource(traefikResources[obj.Kind]).Namespace(SparkNamespace).Delete(ctx, obj.Name, metav1.DeleteOptions{})
+	default:
+		return fmt.Errorf("unsupported object kind %s", obj.Kind)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete %s %s: %w", obj.Kind, obj.Name, err)
+	}
+	return nil
+}
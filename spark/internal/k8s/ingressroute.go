@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Traefik CRDs, as installed by cluster/system/traefik.
+var (
+	ingressRouteResource = schema.GroupVersionResource{Group: "traefik.io", Version: "v1alpha1", Resource: "ingressroutes"}
+	middlewareResource   = schema.GroupVersionResource{Group: "traefik.io", Version: "v1alpha1", Resource: "middlewares"}
+
+	traefikResources = map[string]schema.GroupVersionResource{
+		"IngressRoute": ingressRouteResource,
+		"Middleware":   middlewareResource,
+	}
+)
+
+// secureEntryPoint is the Traefik entry point that terminates TLS.
+const secureEntryPoint = "websecure"
+
+// BasicAuth is a username and password protecting an ingress exposure.
+type BasicAuth struct {
+	Username string
+	Password string
+}
+
+// IngressURL returns the URL a port exposed through Traefik is served at.
+func IngressURL(host, entryPoint string) string {
+	if entryPoint == secureEntryPoint {
+		return "https://" + host
+	}
+	return "http://" + host
+}
+
+func basicAuthName(name string, port int32) string {
+	return exposeObjectName(name, port) + "-auth"
+}
+
+// CreateBasicAuthSecret creates the Secret holding the credentials for an
+// ingress exposure's basic-auth middleware.
+func CreateBasicAuthSecret(name string, port int32, auth BasicAuth) *corev1.Secret {
+	return &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      basicAuthName(name, port),
+			Namespace: SparkNamespace,
+			Labels:    exposeLabels(name, port),
+		},
+		Type: corev1.SecretTypeBasicAuth,
+		StringData: map[string]string{
+			corev1.BasicAuthUsernameKey: auth.Username,
+			corev1.BasicAuthPasswordKey: auth.Password,
+		},
+	}
+}
+
+// CreateBasicAuthMiddleware creates the Traefik Middleware requiring the
+// credentials from CreateBasicAuthSecret.
+func CreateBasicAuthMiddleware(name string, port int32) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "traefik.io/v1alpha1",
+		"kind":       "Middleware",
+		"metadata":   unstructuredMeta(basicAuthName(name, port), exposeLabels(name, port)),
+		"spec": map[string]interface{}{
+			"basicAuth": map[string]interface{}{
+				"secret": basicAuthName(name, port),
+			},
+		},
+	}}
+}
+
+// CreateIngressRoute creates the Traefik IngressRoute serving a spark port at
+// host, behind the basic-auth middleware if auth is set.
+func CreateIngressRoute(name string, port int32, host, entryPoint string, auth bool) *unstructured.Unstructured {
+	route := map[string]interface{}{
+		"match": fmt.Sprintf("Host(`%s`)", host),
+		"kind":  "Rule",
+		"services": []interface{}{
+			map[string]interface{}{
+				"name": exposeObjectName(name, port),
+				"port": int64(port),
+			},
+		},
+	}
+	if auth {
+		route["middlewares"] = []interface{}{
+			map[string]interface{}{"name": basicAuthName(name, port)},
+		}
+	}
+
+	spec := map[string]interface{}{
+		"entryPoints": []interface{}{entryPoint},
+		"routes":      []interface{}{route},
+	}
+	if entryPoint == secureEntryPoint {
+		spec["tls"] = map[string]interface{}{}
+	}
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "traefik.io/v1alpha1",
+		"kind":       "IngressRoute",
+		"metadata":   unstructuredMeta(exposeObjectName(name, port), exposeLabels(name, port)),
+		"spec":       spec,
+	}}
+}
+
+func unstructuredMeta(name string, labels map[string]string) map[string]interface{} {
+	l := make(map[string]interface{}, len(labels))
+	for k, v := range labels {
+		l[k] = v
+	}
+	return map[string]interface{}{
+		"name":      name,
+		"namespace": SparkNamespace,
+		"labels":    l,
+	}
+}
+
+// createIngressRoute creates the Traefik objects for an ingress exposure.
+func (c *Client) createIngressRoute(ctx context.Context, name string, port int32, opts ExposeOptions) error {
+	if opts.BasicAuth != nil {
+		_, err := c.clientset.CoreV1().Secrets(SparkNamespace).Create(ctx, CreateBasicAuthSecret(name, port, *opts.BasicAuth), metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create basic-auth secret: %w", err)
+		}
+
+		_, err = c.dynamic.Resource(middlewareResource).Namespace(SparkNamespace).Create(ctx, CreateBasicAuthMiddleware(name, port), metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to create middleware: %w", err)
+		}
+	}
+
+	route := CreateIngressRoute(name, port, opts.Hostname, opts.EntryPoint, opts.BasicAuth != nil)
+	_, err := c.dynamic.Resource(ingressRouteResource).Namespace(SparkNamespace).Create(ctx, route, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create ingressroute: %w", err)
+	}
+
+	return nil
+}
+
+// deleteIngressRoute deletes the Traefik objects of an ingress exposure, if
+// there are any.
+func (c *Client) deleteIngressRoute(ctx context.Context, name string, port int32) error {
+	err := c.dynamic.Resource(ingressRouteResource).Namespace(SparkNamespace).Delete(ctx, exposeObjectName(name, port), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete ingressroute: %w", err)
+	}
+
+	err = c.dynamic.Resource(middlewareResource).Namespace(SparkNamespace).Delete(ctx, basicAuthName(name, port), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete middleware: %w", err)
+	}
+
+	err = c.clientset.CoreV1().Secrets(SparkNamespace).Delete(ctx, basicAuthName(name, port), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete basic-auth secret: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package k8s
+
+import (
+	"embed"
+	"sort"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// HookNames are the hook scripts a spark runs on every boot: pre-setup
+// before spark sets up the user's environment, post-setup before sshd
+// starts and on-start in the background alongside it.
+var HookNames = []string{"pre-setup", "post-setup", "on-start"}
+
+//go:embed initscript/*.tmpl
+var initScriptFiles embed.FS
+
+var initScriptTemplate = template.Must(template.New("init.sh.tmpl").Funcs(template.FuncMap{
+	"quote":    shellQuote,
+	"quoteAll": quoteAll,
+	"commands": commandScript,
+}).ParseFS(initScriptFiles, "initscript/*.tmpl"))
+
+// initScriptData is what the init script templates are rendered with.
+type initScriptData struct {
+	*SparkResources
+	ProjectDir      string
+	Hostname        string
+	PrebuiltMarker  string
+	PackageManagers []initScriptPackageManager
+	Env             []corev1.EnvVar
+	// Tools are the runtimes as mise tool@version arguments.
+	Tools []string
+	// EnvMountPath holds the spark's env Secret, and SecretEnvNames are the
+	// variables referencing other Secrets.
+	EnvMountPath     string
+	SecretEnvNames   []string
+	InstallEnvScript string
+	// DotfilesInstallScript installs the cloned dotfiles.
+	DotfilesInstallScript string
+	Clones                []initScriptClone
+	CredentialHelper      string
+	NixDir                string
+}
+
+type initScriptClone struct {
+	Repo
+	Script string
+}
+
+type initScriptPackageManager struct {
+	// Patterns is the case pattern matching the distributions it serves.
+	Patterns string
+	Install  string
+	Packages []string
+}
+
+// buildInitScript renders the script the spark's container runs on boot.
+func (s *SparkResources) buildInitScript() (string, error) {
+	data := initScriptData{
+		SparkResources:   s,
+		ProjectDir:       orDefault(s.WorkDir(), ProjectDir),
+		Hostname:         TailscaleHostname(s.Name),
+		PrebuiltMarker:   PrebuiltMarker,
+		Env:              s.environment(),
+		EnvMountPath:     envMountPath,
+		SecretEnvNames:   sortedKeys(s.SecretEnv),
+		InstallEnvScript: installEnvScript,
+		CredentialHelper: githubCredentialHelper,
+		NixDir:           NixDir,
+	}
+	for _, r := range s.repos() {
+		data.Clones = append(data.Clones, initScriptClone{Repo: r, Script: s.cloneScript(r)})
+	}
+	if s.DotfilesRepo != "" {
+		install := s.DotfilesInstall
+		if install == "" {
+			install = defaultDotfilesInstall
+		}
+		data.DotfilesInstallScript = "cd /home/user/.dotfiles && " + install
+	}
+	for _, pm := range packageManagers {
+		var patterns []string
+		for _, id := range pm.osIDs {
+			patterns = append(patterns, `*" `+id+` "*`)
+		}
+		data.PackageManagers = append(data.PackageManagers, initScriptPackageManager{
+			Patterns: strings.Join(patterns, "|"),
+			Install:  pm.install,
+			Packages: s.packagesFor(pm),
+		})
+	}
+	for tool, version := range s.Runtimes {
+		data.Tools = append(data.Tools, tool+"@"+orDefault(version, "latest"))
+	}
+	sort.Strings(data.Tools)
+
+	var script strings.Builder
+	if err := initScriptTemplate.Execute(&script, data); err != nil {
+		return "", err
+	}
+	return script.String(), nil
+}
+
+// defaultDotfilesInstall runs the first install script found in a dotfiles
+// repository, looking for the same names as GitHub Codespaces.
+const defaultDotfilesInstall = `for script in install.sh install bootstrap.sh bootstrap script/bootstrap setup.sh setup script/setup; do
+    if [ -f "$script" ]; then
+        chmod +x "$script"
+        exec "./$script"
+    fi
+done
+echo "No install script found in the dotfiles"`
+
+// commandScript returns commands as a script run in dir, or the home
+// directory if it doesn't exist, stopping at the first failure.
+func commandScript(dir string, commands []string) string {
+	script := "set -e\ncd " + shellQuote(dir) + " 2>/dev/null || cd\n"
+	for _, command := range commands {
+		script += "echo '+ '" + shellQuote(command) + "\n" + command + "\n"
+	}
+	return script
+}
+
+// shellQuote quotes s as a single shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// quoteAll quotes each of words and joins them with spaces.
+func quoteAll(words []string) string {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = shellQuote(word)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// installAuthorizedKeysScript replaces the spark user's authorized_keys with
+// stdin, atomically so sshd never reads a partial file.
+const installAuthorizedKeysScript = `set -e
+mkdir -p /home/user/.ssh
+cat > /home/user/.ssh/authorized_keys.tmp
+chmod 700 /home/user/.ssh
+chmod 600 /home/user/.ssh/authorized_keys.tmp
+chown 1000:1000 /home/user/.ssh /home/user/.ssh/authorized_keys.tmp
+mv /home/user/.ssh/authorized_keys.tmp /home/user/.ssh/authorized_keys`
+
+// GetAuthorizedKeys returns the contents of the spark's authorized_keys.
+func (c *Client) GetAuthorizedKeys(ctx context.Context, name string) (string, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).Get(ctx, name+"-config", metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get configmap: %w", err)
+	}
+	return configMap.Data["authorized_keys"], nil
+}
+
+// SetAuthorizedKeys replaces the spark's authorized_keys. The ConfigMap is
+// updated so the keys survive restarts, and the file in the running pod is
+// rewritten so they apply without one. It reports whether the running pod
+// was updated, which it isn't when the spark has no running pod.
+func (c *Client) SetAuthorizedKeys(ctx context.Context, name, keys string) (bool, error) {
+	configMap, err := c.clientset.CoreV1().ConfigMaps(SparkNamespace).Get(ctx, name+"-config", metav1.GetOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to get configmap: %w", err)
+	}
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data["authorized_keys"] = keys
+
+	_, err = c.clientset.CoreV1().ConfigMaps(SparkNamespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to update configmap: %w", err)
+	}
+
+	if _, err := c.GetSparkPod(ctx, name); err != nil {
+		return false, nil
+	}
+	err = c.Exec(ctx, name, ExecOptions{
+		Command: []string{"sh", "-c", installAuthorizedKeysScript},
+		Stdin:   strings.NewReader(keys),
+		Stdout:  io.Discard,
+		Stderr:  io.Discard,
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to update authorized_keys in the running pod: %w", err)
+	}
+	return true, nil
+}
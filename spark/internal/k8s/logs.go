@@ -0,0 +1,36 @@
+package k8s
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// FollowLog calls fn with each line the spark's container logs, from its
+// start, until fn returns false or the container stops.
+func (c *Client) FollowLog(ctx context.Context, name string, fn func(line string) bool) error {
+	pod, err := c.GetSparkPod(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	stream, err := c.clientset.CoreV1().Pods(SparkNamespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: SparkContainer,
+		Follow:    true,
+	}).Stream(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to follow log: %w", err)
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if !fn(scanner.Text()) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,25 @@
+package k8s
+
+import corev1 "k8s.io/api/core/v1"
+
+// NixDir is where Nix keeps its store. Sparks with Nix mount it from their
+// volume, so installed packages and built dev shells survive restarts.
+const NixDir = "/nix"
+
+// nixSubPath is the directory of the spark's volume mounted at NixDir,
+// which also shows up in the user's home directory.
+const nixSubPath = ".nix"
+
+// nixVolumeMounts returns the mount of the Nix store for sparks with Nix.
+func (s *SparkResources) nixVolumeMounts() []corev1.VolumeMount {
+	if !s.Nix {
+		return nil
+	}
+	return []corev1.VolumeMount{
+		{
+			Name:      "spark-storage",
+			MountPath: NixDir,
+			SubPath:   nixSubPath,
+		},
+	}
+}
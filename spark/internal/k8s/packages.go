@@ -0,0 +1,83 @@
+package k8s
+
+// PrebuiltMarker is the file that marks an image as a prebuilt spark image:
+// one that already has bash, sshd, sudo, curl, git, GNU tar, findutils and
+// runuser installed. Sparks using such an image skip package installation
+// on boot.
+const PrebuiltMarker = "/etc/spark/image"
+
+// packageManager installs packages on a family of distributions.
+type packageManager struct {
+	name string
+	// osIDs are the /etc/os-release ID or ID_LIKE values it serves.
+	osIDs []string
+	// base are the packages every spark needs.
+	base []string
+	// install is a shell command installing the packages in $@, skipping
+	// the work when they are all present.
+	install string
+}
+
+var packageManagers = []packageManager{
+	{
+		name:    "apt",
+		osIDs:   []string{"debian", "ubuntu"},
+		base:    []string{"openssh-server", "sudo", "curl", "git", "ca-certificates"},
+		install: `dpkg -s "$@" >/dev/null 2>&1 || { apt-get update && DEBIAN_FRONTEND=noninteractive apt-get install -y "$@"; }`,
+	},
+	{
+		name:    "apk",
+		osIDs:   []string{"alpine"},
+		base:    []string{"bash", "openssh-server", "sudo", "curl", "git", "ca-certificates", "shadow", "runuser", "tar", "findutils"},
+		install: `apk add --no-cache "$@"`,
+	},
+	{
+		name:    "dnf",
+		osIDs:   []string{"fedora", "rhel", "centos"},
+		base:    []string{"openssh-server", "sudo", "curl", "git", "ca-certificates", "shadow-utils", "util-linux", "tar", "findutils"},
+		install: `rpm -q "$@" >/dev/null 2>&1 || dnf install -y --allowerasing "$@"`,
+	},
+}
+
+// packageAliases translates the Debian package names used by templates to
+// those of the other package managers. Names without an entry are the same
+// everywhere.
+var packageAliases = map[string]map[string][]string{
+	"build-essential":   {"apk": {"build-base"}, "dnf": {"gcc", "gcc-c++", "make"}},
+	"postgresql-client": {"dnf": {"postgresql"}},
+	"libpq-dev":         {"dnf": {"libpq-devel"}},
+	"libssl-dev":        {"apk": {"openssl-dev"}, "dnf": {"openssl-devel"}},
+	"python3-venv":      {"apk": {"python3"}, "dnf": {"python3"}},
+	"gh":                {"apk": {"github-cli"}},
+	"xz-utils":          {"apk": {"xz"}, "dnf": {"xz"}},
+}
+
+// packagesFor returns the base packages of a package manager followed by
+// the spark's, its login shell and what the Nix installer needs, translated
+// to its names.
+func (s *SparkResources) packagesFor(pm packageManager) []string {
+	packages := append([]string(nil), pm.base...)
+	wanted := s.Packages
+	if s.Shell != "" && s.Shell != "bash" {
+		wanted = append(wanted[:len(wanted):len(wanted)], s.Shell)
+	}
+	if s.Nix {
+		wanted = append(wanted[:len(wanted):len(wanted)], "xz-utils")
+	}
+	for _, p := range wanted {
+		names := []string{p}
+		if alias, ok := packageAliases[p][pm.name]; ok {
+			names = alias
+		}
+		for _, name := range names {
+			found := false
+			for _, existing := range packages {
+				found = found || existing == name
+			}
+			if !found {
+				packages = append(packages, name)
+			}
+		}
+	}
+	return packages
+}
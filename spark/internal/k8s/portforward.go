@@ -0,0 +1,63 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	"k8s.io/client-go/tools/portforward"
+	"k8s.io/client-go/transport/spdy"
+)
+
+// PortForward forwards local ports to the spark's running pod. Ports use
+// kubectl's syntax: "3000" forwards local port 3000 to the same remote port
+// and "8080:80" forwards local port 8080 to remote port 80. It blocks until
+// ctx is cancelled or the connection to the pod is lost.
+func (c *Client) PortForward(ctx context.Context, name string, ports []string, out, errOut io.Writer) error {
+	pod, err := c.GetSparkPod(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	req := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(pod.Name).
+		Namespace(SparkNamespace).
+		SubResource("portforward")
+
+	transport, upgrader, err := spdy.RoundTripperFor(c.config)
+	if err != nil {
+		return fmt.Errorf("failed to create port forward client: %w", err)
+	}
+	dialer := spdy.NewDialer(upgrader, &http.Client{Transport: transport}, "POST", req.URL())
+
+	// Prefer tunneling over WebSockets and fall back to SPDY for older API
+	// servers, as kubectl does
+	tunnelingDialer, err := portforward.NewSPDYOverWebsocketDialer(req.URL(), c.config)
+	if err != nil {
+		return fmt.Errorf("failed to create port forward client: %w", err)
+	}
+	dialer = portforward.NewFallbackDialer(tunnelingDialer, dialer, func(err error) bool {
+		return httpstream.IsUpgradeFailure(err) || httpstream.IsHTTPSProxyError(err)
+	})
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			close(stop)
+		case <-done:
+		}
+	}()
+
+	forwarder, err := portforward.New(dialer, ports, stop, nil, out, errOut)
+	if err != nil {
+		return fmt.Errorf("failed to set up port forward: %w", err)
+	}
+
+	return forwarder.ForwardPorts()
+}
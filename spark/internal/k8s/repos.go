@@ -0,0 +1,167 @@
+package k8s
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Repo is a git repository cloned into a spark.
+type Repo struct {
+	URL string
+	// Ref is the branch, tag or commit checked out, the default branch if
+	// empty.
+	Ref string
+	// Path is the clone's directory, absolute or relative to /home/user. The
+	// first repository defaults to ProjectDir and the others to their name.
+	Path string
+}
+
+// commitPattern matches refs that are commit hashes rather than branch or
+// tag names.
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// repoPathPattern matches the clone directories spark accepts.
+var repoPathPattern = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+
+// githubCredentialHelper is a git credential helper answering with the
+// spark's GITHUB_TOKEN, read when git asks so a rotated token is picked up.
+const githubCredentialHelper = `!f() { test "$1" = get && echo username=x-access-token && echo "password=$(cat /tmp/spark-secret/GITHUB_TOKEN)"; }; f`
+
+// ParseRepo parses a repository given as url[@ref][:path]. The ref and path
+// are looked for after the URL's host, so scp-like URLs such as
+// git@github.com:owner/repo and URLs with ports keep their colons.
+func ParseRepo(spec string) (Repo, error) {
+	start := 0
+	if i := strings.Index(spec, "://"); i >= 0 {
+		start = i + 3
+		if j := strings.Index(spec[start:], "/"); j >= 0 {
+			start += j
+		}
+	} else if i := strings.Index(spec, ":"); i >= 0 && !strings.HasPrefix(spec, "/") {
+		start = i + 1
+	}
+
+	repo := Repo{URL: spec}
+	if i := strings.LastIndex(spec[start:], ":"); i >= 0 {
+		repo.Path = spec[start+i+1:]
+		repo.URL = spec[:start+i]
+	}
+	if i := strings.LastIndex(repo.URL[start:], "@"); i >= 0 {
+		repo.Ref = repo.URL[start+i+1:]
+		repo.URL = repo.URL[:start+i]
+	}
+	if repo.URL == "" {
+		return Repo{}, fmt.Errorf("invalid repository %q, expected url[@ref][:path]", spec)
+	}
+	return repo, nil
+}
+
+func (r Repo) String() string {
+	s := r.URL
+	if r.Ref != "" {
+		s += "@" + r.Ref
+	}
+	if r.Path != "" {
+		s += ":" + r.Path
+	}
+	return s
+}
+
+// dir returns the absolute directory the repository is cloned into, the
+// default for the first repository if primary is set.
+func (r Repo) dir(primary bool) string {
+	switch {
+	case path.IsAbs(r.Path):
+		return path.Clean(r.Path)
+	case r.Path != "":
+		return path.Join("/home/user", r.Path)
+	case primary:
+		return ProjectDir
+	}
+	name := strings.TrimSuffix(path.Base(strings.TrimSuffix(r.URL, "/")), ".git")
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name = name[i+1:]
+	}
+	return path.Join("/home/user", name)
+}
+
+// repos returns the spark's repositories with their directories resolved.
+func (s *SparkResources) repos() []Repo {
+	repos := make([]Repo, len(s.Repos))
+	for i, r := range s.Repos {
+		r.Path = r.dir(i == 0)
+		repos[i] = r
+	}
+	return repos
+}
+
+// WorkDir returns the directory of the spark's first repository, where
+// commands and hooks run, or an empty string without one.
+func (s *SparkResources) WorkDir() string {
+	if len(s.Repos) == 0 {
+		return ""
+	}
+	return s.Repos[0].dir(true)
+}
+
+// validateRepos checks that the repositories can be cloned side by side in
+// the spark user's home directory.
+func (s *SparkResources) validateRepos() error {
+	if s.CloneDepth < 0 {
+		return fmt.Errorf("invalid clone depth %d", s.CloneDepth)
+	}
+	dirs := make(map[string]string)
+	for _, r := range s.repos() {
+		if strings.ContainsAny(r.Ref, " \t\n") || strings.HasPrefix(r.Ref, "-") {
+			return fmt.Errorf("invalid ref %q for %s", r.Ref, r.URL)
+		}
+		if !repoPathPattern.MatchString(r.Path) {
+			return fmt.Errorf("invalid path %q for %s", r.Path, r.URL)
+		}
+		if !strings.HasPrefix(r.Path, "/home/user/") {
+			return fmt.Errorf("%s must be cloned inside /home/user, not %s", r.URL, r.Path)
+		}
+		if other, ok := dirs[r.Path]; ok {
+			return fmt.Errorf("%s and %s are both cloned into %s; give one a path with url:path", other, r.URL, r.Path)
+		}
+		dirs[r.Path] = r.URL
+	}
+	return nil
+}
+
+// cloneScript returns the commands cloning a repository into its directory,
+// checking out its ref and submodules.
+func (s *SparkResources) cloneScript(r Repo) string {
+	clone := []string{"git", "clone"}
+	checkout := ""
+	switch {
+	case commitPattern.MatchString(r.Ref):
+		// Shallow clones can't be relied on to contain an arbitrary commit
+		clone = append(clone, "--no-checkout")
+		checkout = "git -C " + shellQuote(r.Path) + " checkout --detach " + shellQuote(r.Ref)
+	case r.Ref != "":
+		clone = append(clone, "--branch", shellQuote(r.Ref))
+		fallthrough
+	default:
+		if s.CloneDepth > 0 {
+			clone = append(clone, "--depth", strconv.Itoa(s.CloneDepth))
+		}
+	}
+	clone = append(clone, "--", shellQuote(r.URL), shellQuote(r.Path))
+
+	script := "set -e\nexport GIT_TERMINAL_PROMPT=0\n" + strings.Join(clone, " ") + "\n"
+	if checkout != "" {
+		script += checkout + "\n"
+	}
+	if s.Submodules {
+		submodules := "git -C " + shellQuote(r.Path) + " submodule update --init --recursive"
+		if s.CloneDepth > 0 {
+			submodules += " --depth " + strconv.Itoa(s.CloneDepth)
+		}
+		script += submodules + "\n"
+	}
+	return script
+}
@@ -0,0 +1,47 @@
+package k8s
+
+import "testing"
+
+func TestParseRepo(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    Repo
+		wantErr bool
+	}{
+		{name: "https", spec: "https://github.com/o/r", want: Repo{URL: "https://github.com/o/r"}},
+		{name: "https ref", spec: "https://github.com/o/r@v1.2", want: Repo{URL: "https://github.com/o/r", Ref: "v1.2"}},
+		{name: "https path", spec: "https://github.com/o/r:src/r", want: Repo{URL: "https://github.com/o/r", Path: "src/r"}},
+		{name: "https ref and path", spec: "https://github.com/o/r.git@main:/home/user/r", want: Repo{URL: "https://github.com/o/r.git", Ref: "main", Path: "/home/user/r"}},
+		{name: "userinfo", spec: "https://x-access-token@github.com/o/r@dev", want: Repo{URL: "https://x-access-token@github.com/o/r", Ref: "dev"}},
+		{name: "port", spec: "ssh://git@git.example.com:2222/o/r.git", want: Repo{URL: "ssh://git@git.example.com:2222/o/r.git"}},
+		{name: "port ref and path", spec: "https://git.example.com:8443/o/r@abc1234:r", want: Repo{URL: "https://git.example.com:8443/o/r", Ref: "abc1234", Path: "r"}},
+		{name: "scp-like", spec: "git@github.com:o/r.git", want: Repo{URL: "git@github.com:o/r.git"}},
+		{name: "scp-like ref", spec: "git@github.com:o/r@feature/x", want: Repo{URL: "git@github.com:o/r", Ref: "feature/x"}},
+		{name: "scp-like ref and path", spec: "git@github.com:o/r@ref:path", want: Repo{URL: "git@github.com:o/r", Ref: "ref", Path: "path"}},
+		{name: "local path", spec: "/srv/git/r.git", want: Repo{URL: "/srv/git/r.git"}},
+		{name: "local path ref and path", spec: "/srv/git/r.git@main:r", want: Repo{URL: "/srv/git/r.git", Ref: "main", Path: "r"}},
+		{name: "empty", spec: "", wantErr: true},
+		{name: "ref only", spec: "@main", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRepo(tt.spec)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRepo(%q) = %+v, want error", tt.spec, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRepo(%q) error = %v", tt.spec, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRepo(%q) = %+v, want %+v", tt.spec, got, tt.want)
+			}
+			if s := got.String(); s != tt.spec {
+				t.Errorf("ParseRepo(%q).String() = %q", tt.spec, s)
+			}
+		})
+	}
+}
@@ -1,6 +1,13 @@
 package k8s
 
 import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/t-eckert/homelab/spark/internal/names"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -9,20 +16,190 @@ import (
 
 // SparkResources holds the configuration for creating Kubernetes resources for a spark.
 type SparkResources struct {
-	Name            string
-	GitRepo         string
+	Name string
+	// Repos are cloned into the spark on its first boot.
+	Repos           []Repo
+	CloneDepth      int
+	Submodules      bool
 	DatabaseURL     string
 	AnthropicAPIKey string
-	SSHPublicKey    string
-	GitHubToken     string
+	// SSHPublicKey is the contents of the spark user's authorized_keys,
+	// one or more public keys.
+	SSHPublicKey string
+	GitHubToken  string
+
+	// HostPrivateKey and HostPublicKey are the spark's persistent SSH host
+	// key pair, stored in its Secret so sshd keeps the same identity across
+	// restarts.
+	HostPrivateKey string
+	HostPublicKey  string
+
+	// The spark's environment, resolved from its template. Empty fields
+	// fall back to the defaults below.
+	Image    string
+	Packages []string
+	// Runtimes maps language runtimes and tools installed with mise to
+	// their versions.
+	Runtimes   map[string]string
+	Env        map[string]string
+	CPU        string
+	Memory     string
+	Storage    string
+	Addons     []string
+	PostCreate []string
+	// PostStart runs in the background as the spark user on every boot.
+	PostStart []string
+	// ForwardPorts are forwarded by 'spark forward' when no ports are
+	// given.
+	ForwardPorts []string
+
+	// UserEnv are variables given on the command line, kept in the spark's
+	// env Secret. SecretEnv are variables taken from existing Secrets.
+	UserEnv   map[string]string
+	SecretEnv map[string]SecretRef
+
+	// The spark user's identity. Without a dotfiles repository none are
+	// installed, and the shell defaults to bash.
+	DotfilesRepo    string
+	DotfilesInstall string
+	GitName         string
+	GitEmail        string
+	GitHubUser      string
+	Shell           string
+
+	// Nix installs single-user Nix with its store on the spark's volume,
+	// and enters the devShell of the first repository's flake.
+	Nix bool
+
+	// Hooks maps hook names to the scripts run at those points of every
+	// boot, in addition to those in the repository's .spark/hooks.
+	Hooks map[string]string
+}
+
+// Defaults for a spark's environment.
+const (
+	DefaultImage   = "debian:bookworm"
+	DefaultCPU     = "1000m"
+	DefaultMemory  = "2Gi"
+	DefaultStorage = "10Gi"
+)
+
+// Shells are the login shells a spark user can have.
+var Shells = []string{"bash", "zsh"}
+
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks the spark's environment settings before anything is
+// created from them.
+func (s *SparkResources) Validate() error {
+	for name, value := range map[string]string{"cpu": s.CPU, "memory": s.Memory, "storage": s.Storage} {
+		if value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s %q: %w", name, value, err)
+		}
+		if quantity.Sign() <= 0 {
+			return fmt.Errorf("invalid %s %q: must be more than zero", name, value)
+		}
+	}
+	for name := range s.Env {
+		if !envNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+	for name := range s.UserEnv {
+		if err := ValidateEnvName(name); err != nil {
+			return err
+		}
+	}
+	for name := range s.SecretEnv {
+		if err := ValidateEnvName(name); err != nil {
+			return err
+		}
+	}
+	for tool, version := range s.Runtimes {
+		if tool == "" || strings.ContainsAny(tool+version, " \t\n") {
+			return fmt.Errorf("invalid runtime %s@%s", tool, version)
+		}
+	}
+	if s.GitHubUser != "" {
+		if err := names.ValidateGitHubUser(s.GitHubUser); err != nil {
+			return err
+		}
+	}
+	if s.Shell != "" && !slices.Contains(Shells, s.Shell) {
+		return fmt.Errorf("unsupported shell %q, expected one of %s", s.Shell, strings.Join(Shells, ", "))
+	}
+	if err := s.validateRepos(); err != nil {
+		return err
+	}
+	return validateAddons(s.Addons)
 }
 
+// ImageName returns the spark's base image.
+func (s *SparkResources) ImageName() string {
+	return orDefault(s.Image, DefaultImage)
+}
+
+// environment returns the variables set by the spark's add-ons and template,
+// sorted by name. The template's win over the add-ons', and those given on
+// the command line are left out so they win over both.
+func (s *SparkResources) environment() []corev1.EnvVar {
+	merged := make(map[string]string)
+	for _, name := range s.Addons {
+		for k, v := range addons[name].env {
+			merged[k] = v
+		}
+	}
+	for k, v := range s.Env {
+		merged[k] = v
+	}
+	for k := range s.UserEnv {
+		delete(merged, k)
+	}
+	for k := range s.SecretEnv {
+		delete(merged, k)
+	}
+
+	env := make([]corev1.EnvVar, 0, len(merged))
+	for k, v := range merged {
+		env = append(env, corev1.EnvVar{Name: k, Value: v})
+	}
+	sort.Slice(env, func(i, j int) bool {
+		return env[i].Name < env[j].Name
+	})
+	return env
+}
+
+// bootstrapScript starts the init script, given as its first argument, with
+// bash, installing bash first on images such as Alpine that lack it.
+const bootstrapScript = `if ! command -v bash >/dev/null 2>&1 && command -v apk >/dev/null 2>&1; then
+    apk add --no-cache bash
+fi
+exec bash -c "$1"`
+
 // SparkNamespace is the Kubernetes namespace where sparks are deployed.
 const SparkNamespace = "spark"
 
+// Secret keys holding a spark's SSH host key pair.
+const (
+	HostPrivateKeySecretKey = "ssh_host_ed25519_key"
+	HostPublicKeySecretKey  = "ssh_host_ed25519_key.pub"
+)
+
+// ProjectDir is where a spark's first git repository is cloned by default.
+const ProjectDir = "/home/user/project"
+
+// TailscaleHostname returns the tailnet hostname of a spark.
+func TailscaleHostname(name string) string {
+	return "spark-" + name
+}
+
 // CreateConfigMap creates a ConfigMap for the spark.
 func (s *SparkResources) CreateConfigMap() *corev1.ConfigMap {
-	return &corev1.ConfigMap{
+	configMap := &corev1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      s.Name + "-config",
 			Namespace: SparkNamespace,
@@ -33,9 +210,19 @@ func (s *SparkResources) CreateConfigMap() *corev1.ConfigMap {
 		},
 		Data: map[string]string{
 			"authorized_keys": s.SSHPublicKey,
-			"git_repo":        s.GitRepo,
+			"forward_ports":   strings.Join(s.ForwardPorts, " "),
+			"project_dir":     s.WorkDir(),
 		},
 	}
+	var repos []string
+	for _, r := range s.Repos {
+		repos = append(repos, r.String())
+	}
+	configMap.Data["repos"] = strings.Join(repos, "\n")
+	for name, script := range s.Hooks {
+		configMap.Data["hook-"+name] = script
+	}
+	return configMap
 }
 
 // CreateSecret creates a Secret for the spark.
@@ -50,9 +237,11 @@ func (s *SparkResources) CreateSecret() *corev1.Secret {
 			},
 		},
 		StringData: map[string]string{
-			"DATABASE_URL":      s.DatabaseURL,
-			"ANTHROPIC_API_KEY": s.AnthropicAPIKey,
-			"GITHUB_TOKEN":      s.GitHubToken,
+			"DATABASE_URL":          s.DatabaseURL,
+			"ANTHROPIC_API_KEY":     s.AnthropicAPIKey,
+			"GITHUB_TOKEN":          s.GitHubToken,
+			HostPrivateKeySecretKey: s.HostPrivateKey,
+			HostPublicKeySecretKey:  s.HostPublicKey,
 		},
 	}
 }
@@ -74,7 +263,7 @@ func (s *SparkResources) CreatePVC() *corev1.PersistentVolumeClaim {
 			},
 			Resources: corev1.VolumeResourceRequirements{
 				Requests: corev1.ResourceList{
-					corev1.ResourceStorage: resource.MustParse("10Gi"),
+					corev1.ResourceStorage: resource.MustParse(orDefault(s.Storage, DefaultStorage)),
 				},
 			},
 		},
@@ -92,7 +281,7 @@ func (s *SparkResources) CreateService() *corev1.Service {
 				"spark-name": s.Name,
 			},
 			Annotations: map[string]string{
-				"tailscale.com/hostname": "spark-" + s.Name,
+				"tailscale.com/hostname": TailscaleHostname(s.Name),
 			},
 		},
 		Spec: corev1.ServiceSpec{
@@ -114,12 +303,19 @@ func (s *SparkResources) CreateService() *corev1.Service {
 }
 
 // CreateDeployment creates a Deployment for the spark.
-func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
+func (s *SparkResources) CreateDeployment() (*appsv1.Deployment, error) {
 	replicas := int32(1)
 	runAsUser := int64(0)
 	fsGroup := int64(1000)
 
-	initScript := s.buildInitScript()
+	initScript, err := s.buildInitScript()
+	if err != nil {
+		return nil, fmt.Errorf("failed to render init script: %w", err)
+	}
+	resources, err := containerResources(s.CPU, s.Memory)
+	if err != nil {
+		return nil, err
+	}
 
 	return &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -149,13 +345,15 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 					SecurityContext: &corev1.PodSecurityContext{
 						FSGroup: &fsGroup,
 					},
-					Containers: []corev1.Container{
+					Containers: append([]corev1.Container{
 						{
-							Name:  "debian",
-							Image: "debian:bookworm",
+							Name:  SparkContainer,
+							Image: s.ImageName(),
 							Command: []string{
-								"/bin/bash",
+								"/bin/sh",
 								"-c",
+								bootstrapScript,
+								"spark-init",
 								initScript,
 							},
 							Ports: []corev1.ContainerPort{
@@ -165,7 +363,7 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 									Protocol:      corev1.ProtocolTCP,
 								},
 							},
-							Env: []corev1.EnvVar{
+							Env: append([]corev1.EnvVar{
 								{
 									Name: "DATABASE_URL",
 									ValueFrom: &corev1.EnvVarSource{
@@ -192,8 +390,17 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 									Name:  "SPARK_NAME",
 									Value: s.Name,
 								},
+							}, append(s.environment(), secretEnvVars(s.SecretEnv)...)...),
+							EnvFrom: []corev1.EnvFromSource{
+								{
+									SecretRef: &corev1.SecretEnvSource{
+										LocalObjectReference: corev1.LocalObjectReference{
+											Name: envSecretName(s.Name),
+										},
+									},
+								},
 							},
-							VolumeMounts: []corev1.VolumeMount{
+							VolumeMounts: append([]corev1.VolumeMount{
 								{
 									Name:      "spark-storage",
 									MountPath: "/home/user",
@@ -208,22 +415,18 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 									MountPath: "/tmp/spark-secret",
 									ReadOnly:  true,
 								},
+								{
+									Name:      "spark-env",
+									MountPath: envMountPath,
+									ReadOnly:  true,
+								},
 								{
 									Name:      "spark-tools",
 									MountPath: "/home/user/.local",
 									ReadOnly:  true,
 								},
-							},
-							Resources: corev1.ResourceRequirements{
-								Requests: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("100m"),
-									corev1.ResourceMemory: resource.MustParse("256Mi"),
-								},
-								Limits: corev1.ResourceList{
-									corev1.ResourceCPU:    resource.MustParse("1000m"),
-									corev1.ResourceMemory: resource.MustParse("2Gi"),
-								},
-							},
+							}, s.nixVolumeMounts()...),
+							Resources: resources,
 							SecurityContext: &corev1.SecurityContext{
 								RunAsUser:                &runAsUser,
 								AllowPrivilegeEscalation: boolPtr(true),
@@ -236,7 +439,7 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 								ReadOnlyRootFilesystem: boolPtr(false),
 							},
 						},
-					},
+					}, s.addonContainers()...),
 					Volumes: []corev1.Volume{
 						{
 							Name: "spark-storage",
@@ -261,6 +464,17 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 							VolumeSource: corev1.VolumeSource{
 								Secret: &corev1.SecretVolumeSource{
 									SecretName: s.Name + "-secret",
+									// Holds the host private key, which the
+									// init script installs
+									DefaultMode: int32Ptr(0o400),
+								},
+							},
+						},
+						{
+							Name: "spark-env",
+							VolumeSource: corev1.VolumeSource{
+								Secret: &corev1.SecretVolumeSource{
+									SecretName: envSecretName(s.Name),
 								},
 							},
 						},
@@ -277,149 +491,54 @@ func (s *SparkResources) CreateDeployment() *appsv1.Deployment {
 				},
 			},
 		},
-	}
+	}, nil
 }
 
-func (s *SparkResources) buildInitScript() string {
-	script := `#!/bin/bash
-set -e
-
-echo "==> Installing dependencies..."
-# Install dependencies
-apt-get update && apt-get install -y \
-    openssh-server \
-    sudo \
-    curl \
-    git \
-    wget \
-    vim \
-    tmux \
-    build-essential \
-    ca-certificates \
-    postgresql-client
-
-echo "==> Creating user..."
-# Create user with sudo access (only if doesn't exist)
-if ! id -u user >/dev/null 2>&1; then
-    useradd -u 1000 -m -d /home/user -s /bin/bash user
-    echo "User created successfully"
-else
-    echo "User already exists"
-fi
-
-echo "user ALL=(ALL) NOPASSWD:ALL" > /etc/sudoers.d/user
-chmod 440 /etc/sudoers.d/user
-
-echo "==> Setting up dotfiles tools..."
-# Activate dotfiles tools if available (mounted at /home/user/.local)
-if [ -f /home/user/.local/activate.sh ]; then
-    chmod +x /home/user/.local/activate.sh
-    echo "Dotfiles tools volume found and will be available in PATH"
-else
-    echo "Dotfiles tools volume not yet mounted (will be available after initialization)"
-fi
-
-echo "==> Setting up SSH..."
-# Create user home directory structure
-mkdir -p /home/user/.ssh /home/user/.local/bin /home/user/.config
-
-# Copy authorized keys from ConfigMap
-cp /tmp/spark-config/authorized_keys /home/user/.ssh/authorized_keys
-chmod 600 /home/user/.ssh/authorized_keys
-chmod 700 /home/user/.ssh
-
-# Configure GitHub CLI authentication
-mkdir -p /home/user/.config/gh
-if [ -f /tmp/spark-secret/GITHUB_TOKEN ]; then
-    echo "github.com:" > /home/user/.config/gh/hosts.yml
-    echo "    user: t-eckert" >> /home/user/.config/gh/hosts.yml
-    echo "    oauth_token: $(cat /tmp/spark-secret/GITHUB_TOKEN)" >> /home/user/.config/gh/hosts.yml
-    echo "    git_protocol: https" >> /home/user/.config/gh/hosts.yml
-    chmod 700 /home/user/.config/gh
-    chmod 600 /home/user/.config/gh/hosts.yml
-fi
-
-echo "==> Installing Claude Code..."
-# Install Claude Code CLI as user (using official install script)
-su - user -c "curl -fsSL https://claude.ai/install.sh | bash" || echo "Claude Code installation failed, continuing..."
-
-echo "==> Cloning dotfiles..."
-# Clone dotfiles if not already present
-if [ ! -d /home/user/.dotfiles ]; then
-    su - user -c "git clone https://github.com/t-eckert/dotfiles.git /home/user/.dotfiles" || echo "Dotfiles clone failed, continuing..."
-    su - user -c "cd /home/user/.dotfiles && ./install.sh" || echo "Dotfiles install failed, continuing..."
-else
-    echo "Dotfiles already present"
-fi
-`
-
-	if s.GitRepo != "" {
-		script += `
-# Clone user's git repository
-REPO_URL="` + s.GitRepo + `"
-if [ -n "$REPO_URL" ] && [ ! -d /home/user/project ]; then
-    su - user -c "git clone $REPO_URL /home/user/project"
-fi
-`
+// containerResources returns the requests and limits of a spark's
+// container, the defaults for empty limits. It requests little so idle
+// sparks pack onto the nodes, but never more than its limits.
+func containerResources(cpu, memory string) (corev1.ResourceRequirements, error) {
+	cpuLimit, err := resource.ParseQuantity(orDefault(cpu, DefaultCPU))
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid cpu %q: %w", cpu, err)
 	}
+	memoryLimit, err := resource.ParseQuantity(orDefault(memory, DefaultMemory))
+	if err != nil {
+		return corev1.ResourceRequirements{}, fmt.Errorf("invalid memory %q: %w", memory, err)
+	}
+	resources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("100m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    cpuLimit,
+			corev1.ResourceMemory: memoryLimit,
+		},
+	}
+	for name, limit := range resources.Limits {
+		if request := resources.Requests[name]; request.Cmp(limit) > 0 {
+			resources.Requests[name] = limit
+		}
+	}
+	return resources, nil
+}
 
-	script += `
-echo "==> Setting ownership and permissions..."
-# Set ownership
-chown -R 1000:1000 /home/user
-# Fix home directory permissions (SSH requires 755 or stricter)
-chmod 755 /home/user
-
-echo "==> Configuring SSH daemon..."
-# Configure SSH
-mkdir -p /run/sshd
-ssh-keygen -A
-
-# Configure sshd_config
-cat >> /etc/ssh/sshd_config <<EOF
-PermitRootLogin no
-PasswordAuthentication no
-PubkeyAuthentication yes
-AllowUsers user
-# Accept environment variables from client
-AcceptEnv LANG LC_* DATABASE_URL ANTHROPIC_API_KEY SPARK_NAME
-# Pass environment variables to PAM session
-PermitUserEnvironment yes
-EOF
-
-# Create environment file for SSH sessions
-cat > /home/user/.ssh/environment <<EOF
-DATABASE_URL=$DATABASE_URL
-ANTHROPIC_API_KEY=$ANTHROPIC_API_KEY
-SPARK_NAME=$SPARK_NAME
-EOF
-chmod 600 /home/user/.ssh/environment
-chown user:user /home/user/.ssh/environment
-
-# Add dotfiles tools activation to user's bashrc
-if [ -f /home/user/.local/activate.sh ]; then
-    echo "" >> /home/user/.bashrc
-    echo "# Activate dotfiles tools" >> /home/user/.bashrc
-    echo "source /home/user/.local/activate.sh 2>/dev/null || true" >> /home/user/.bashrc
-    chown user:user /home/user/.bashrc
-fi
-
-echo "==> Verifying user exists before starting SSH..."
-id user || (echo "ERROR: user does not exist!" && exit 1)
-
-echo "==> Starting SSH daemon..."
-echo "Spark is ready! Connect with: ssh user@spark-` + s.Name + `"
-# Start SSH daemon in foreground
-exec /usr/sbin/sshd -D -e
-`
-
-	return script
+func orDefault(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
 }
 
 func stringPtr(s string) *string {
 	return &s
 }
 
+func int32Ptr(i int32) *int32 {
+	return &i
+}
+
 func boolPtr(b bool) *bool {
 	return &b
 }
@@ -0,0 +1,130 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GetSize returns the CPU and memory limits of a spark's container.
+func (c *Client) GetSize(ctx context.Context, name string) (cpu, memory string, err error) {
+	deployment, err := c.GetDeployment(ctx, name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get deployment: %w", err)
+	}
+	container := sparkContainer(deployment.Spec.Template.Spec.Containers)
+	if container == nil {
+		return "", "", fmt.Errorf("deployment %s has no %s container", name, SparkContainer)
+	}
+	return container.Resources.Limits.Cpu().String(), container.Resources.Limits.Memory().String(), nil
+}
+
+// ResizeSpark sets the CPU and memory limits of a spark's container, keeping
+// the current limit for either given empty. Updating the Deployment restarts
+// the spark.
+func (c *Client) ResizeSpark(ctx context.Context, name, cpu, memory string) error {
+	deployment, err := c.GetDeployment(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get deployment: %w", err)
+	}
+	containers := deployment.Spec.Template.Spec.Containers
+	container := sparkContainer(containers)
+	if container == nil {
+		return fmt.Errorf("deployment %s has no %s container", name, SparkContainer)
+	}
+
+	resize := &SparkResources{
+		CPU:    orDefault(cpu, container.Resources.Limits.Cpu().String()),
+		Memory: orDefault(memory, container.Resources.Limits.Memory().String()),
+	}
+	if err := resize.Validate(); err != nil {
+		return err
+	}
+	container.Resources, err = containerResources(resize.CPU, resize.Memory)
+	if err != nil {
+		return err
+	}
+	if err := c.checkCapacity(ctx, containers); err != nil {
+		return err
+	}
+
+	_, err = c.clientset.AppsV1().Deployments(SparkNamespace).Update(ctx, deployment, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update deployment: %w", err)
+	}
+	return nil
+}
+
+// checkCapacity checks that a spark pod with containers fits in the spark
+// namespace's resource quotas and on a node. The whole pod must fit even
+// when it replaces one, as the Deployment starts the new pod before
+// stopping the old.
+func (c *Client) checkCapacity(ctx context.Context, containers []corev1.Container) error {
+	want := podResources(containers)
+
+	quotas, err := c.clientset.CoreV1().ResourceQuotas(SparkNamespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list resource quotas: %w", err)
+	}
+	for _, quota := range quotas.Items {
+		for name, hard := range quota.Status.Hard {
+			need, ok := want[name]
+			if !ok {
+				continue
+			}
+			available := hard.DeepCopy()
+			available.Sub(quota.Status.Used[name])
+			if need.Cmp(available) > 0 {
+				return fmt.Errorf("the spark needs %s of %s but quota %s in the %s namespace has %s left", need.String(), name, quota.Name, SparkNamespace, available.String())
+			}
+		}
+	}
+
+	// Listing nodes needs cluster-wide access, so without it only the
+	// quotas are checked
+	nodes, err := c.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil || len(nodes.Items) == 0 {
+		return nil
+	}
+	for _, name := range []corev1.ResourceName{corev1.ResourceCPU, corev1.ResourceMemory} {
+		need := want[corev1.ResourceName("limits."+name)]
+		var largest resource.Quantity
+		for _, node := range nodes.Items {
+			if allocatable := node.Status.Allocatable[name]; allocatable.Cmp(largest) > 0 {
+				largest = allocatable
+			}
+		}
+		if need.Cmp(largest) > 0 {
+			return fmt.Errorf("the spark's %s limit of %s is more than any node has, the largest has %s", name, need.String(), largest.String())
+		}
+	}
+	return nil
+}
+
+// podResources sums the requests and limits of a pod's containers under
+// the names resource quotas use.
+func podResources(containers []corev1.Container) corev1.ResourceList {
+	total := corev1.ResourceList{corev1.ResourcePods: resource.MustParse("1")}
+	add := func(name corev1.ResourceName, quantity resource.Quantity) {
+		sum, ok := total[name]
+		if !ok {
+			total[name] = quantity.DeepCopy()
+			return
+		}
+		sum.Add(quantity)
+		total[name] = sum
+	}
+	for _, container := range containers {
+		for name, quantity := range container.Resources.Requests {
+			add(name, quantity)
+			add("requests."+name, quantity)
+		}
+		for name, quantity := range container.Resources.Limits {
+			add("limits."+name, quantity)
+		}
+	}
+	return total
+}
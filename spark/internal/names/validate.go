@@ -0,0 +1,80 @@
+package names
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// MaxLength is the longest spark name accepted. Spark names are used as
+// Kubernetes object names (with suffixes such as "-storage"), as the
+// Tailscale hostname "spark-<name>" and as a PostgreSQL database name, so the
+// limit leaves room for those prefixes and suffixes within the 63 character
+// DNS label and Postgres identifier limits.
+const MaxLength = 40
+
+// namePattern is a DNS-1123 label that must also start with a letter so it is
+// a valid DNS-1035 label (required for Service names) and needs no special
+// handling as a Postgres identifier or in shell strings.
+var namePattern = regexp.MustCompile(`^[a-z]([a-z0-9-]*[a-z0-9])?$`)
+
+// Validate reports whether name is safe to use as a spark name.
+func Validate(name string) error {
+	if name == "" {
+		return fmt.Errorf("spark name must not be empty")
+	}
+	if len(name) > MaxLength {
+		return fmt.Errorf("spark name %q is too long (%d characters, max %d)", name, len(name), MaxLength)
+	}
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("spark name %q is invalid: must consist of lowercase letters, digits and '-', start with a letter and end with a letter or digit", name)
+	}
+	return nil
+}
+
+// githubUserPattern matches GitHub usernames, which are also used in URLs
+// and in the shell commands fetching a user's keys and dotfiles.
+var githubUserPattern = regexp.MustCompile(`^[A-Za-z0-9](?:[A-Za-z0-9-]*[A-Za-z0-9])?$`)
+
+// ValidateGitHubUser reports whether user is a valid GitHub username.
+func ValidateGitHubUser(user string) error {
+	if !githubUserPattern.MatchString(user) {
+		return fmt.Errorf("invalid GitHub user %q", user)
+	}
+	return nil
+}
+
+// MaxCheckpointLabelLength is the longest checkpoint label accepted. A
+// checkpoint is stored as a database named "<spark-name>__<label>", which must
+// fit in Postgres's 63 character identifier limit.
+const MaxCheckpointLabelLength = 20
+
+var labelPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?$`)
+
+// PreRollbackLabel is the checkpoint holding a spark's database as it was
+// immediately before the most recent rollback. Spark saves it itself, so it
+// can't be used as the label of a new checkpoint.
+const PreRollbackLabel = "pre-rollback"
+
+// ValidateCheckpointLabel reports whether label is safe to use as the label
+// of a new database checkpoint.
+func ValidateCheckpointLabel(label string) error {
+	if label == PreRollbackLabel {
+		return fmt.Errorf("checkpoint label %q is reserved for the database replaced by a rollback", label)
+	}
+	return ValidateCheckpointRef(label)
+}
+
+// ValidateCheckpointRef reports whether label is a valid label of an
+// existing checkpoint, including those spark saves itself.
+func ValidateCheckpointRef(label string) error {
+	if label == "" {
+		return fmt.Errorf("checkpoint label must not be empty")
+	}
+	if len(label) > MaxCheckpointLabelLength {
+		return fmt.Errorf("checkpoint label %q is too long (%d characters, max %d)", label, len(label), MaxCheckpointLabelLength)
+	}
+	if !labelPattern.MatchString(label) {
+		return fmt.Errorf("checkpoint label %q is invalid: must consist of lowercase letters, digits and '-' and start and end with a letter or digit", label)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package sshclient
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/term"
+)
+
+// Errors returned by Dial, distinguishing why a connection failed.
+var (
+	// ErrUnreachable means the host could not be resolved or connected to.
+	ErrUnreachable = errors.New("host unreachable")
+	// ErrAuthFailed means the server rejected every offered key.
+	ErrAuthFailed = errors.New("authentication failed")
+	// ErrHostKeyMismatch means the server presented a different host key
+	// than the one pinned for it.
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	// ErrHostKeyUnknown means no host key is pinned for the server.
+	ErrHostKeyUnknown = errors.New("host key unknown")
+)
+
+// Options configures a connection to a spark.
+type Options struct {
+	// Host is the hostname to connect to on port 22.
+	Host string
+	// User is the login user.
+	User string
+	// HostKey is the pinned host public key in authorized_keys format. If
+	// empty, the host is verified against KnownHostsPath instead.
+	HostKey string
+	// KnownHostsPath is the known_hosts file used when HostKey is empty. A
+	// missing file has no keys.
+	KnownHostsPath string
+	// TrustHostKey is asked whether to trust a host key that is neither
+	// pinned nor in KnownHostsPath, and to remember it if so. Without it,
+	// such keys are rejected.
+	TrustHostKey func(key ssh.PublicKey) bool
+	// PrivateKeyPath is a private key offered in addition to the keys held
+	// by the SSH agent.
+	PrivateKeyPath string
+}
+
+// Client is an SSH connection to a spark.
+type Client struct {
+	*ssh.Client
+	agent agent.ExtendedAgent
+}
+
+// Dial connects and authenticates to the host described by opts.
+func Dial(opts Options) (*Client, error) {
+	hostKeyCallback, err := hostKeyCallback(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var agentClient agent.ExtendedAgent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentClient = agent.NewClient(conn)
+		}
+	}
+
+	config := &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            authMethods(agentClient, opts.PrivateKeyPath),
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         10 * time.Second,
+	}
+
+	addr := net.JoinHostPort(opts.Host, "22")
+	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnreachable, opts.Host, err)
+	}
+
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		conn.Close()
+		switch {
+		case errors.Is(err, ErrHostKeyMismatch), errors.Is(err, ErrHostKeyUnknown):
+			return nil, errors.Unwrap(err)
+		case strings.Contains(err.Error(), "unable to authenticate"):
+			return nil, fmt.Errorf("%w for %s@%s: %v", ErrAuthFailed, opts.User, opts.Host, err)
+		default:
+			return nil, fmt.Errorf("ssh handshake with %s failed: %w", opts.Host, err)
+		}
+	}
+
+	return &Client{Client: ssh.NewClient(sshConn, chans, reqs), agent: agentClient}, nil
+}
+
+// hostKeyCallback verifies the server against the pinned key, falling back
+// to known_hosts for hosts without one.
+func hostKeyCallback(opts Options) (ssh.HostKeyCallback, error) {
+	if opts.HostKey == "" {
+		callback := func(string, net.Addr, ssh.PublicKey) error {
+			return &knownhosts.KeyError{}
+		}
+		if _, err := os.Stat(opts.KnownHostsPath); !os.IsNotExist(err) {
+			callback, err = knownhosts.New(opts.KnownHostsPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", opts.KnownHostsPath, err)
+			}
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := callback(hostname, remote, key)
+			var keyErr *knownhosts.KeyError
+			if errors.As(err, &keyErr) {
+				if len(keyErr.Want) == 0 {
+					if opts.TrustHostKey != nil && opts.TrustHostKey(key) {
+						return nil
+					}
+					return fmt.Errorf("%w: no key for %s in %s", ErrHostKeyUnknown, opts.Host, opts.KnownHostsPath)
+				}
+				return fmt.Errorf("%w: %s presented %s, which does not match %s",
+					ErrHostKeyMismatch, opts.Host, ssh.FingerprintSHA256(key), opts.KnownHostsPath)
+			}
+			return err
+		}, nil
+	}
+
+	pinned, _, _, _, err := ssh.ParseAuthorizedKey([]byte(opts.HostKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pinned host key: %w", err)
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if !bytes.Equal(key.Marshal(), pinned.Marshal()) {
+			return fmt.Errorf("%w: %s presented %s, expected pinned key %s",
+				ErrHostKeyMismatch, opts.Host, ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(pinned))
+		}
+		return nil
+	}, nil
+}
+
+// authMethods offers the agent's keys followed by the private key file.
+func authMethods(agentClient agent.ExtendedAgent, privateKeyPath string) []ssh.AuthMethod {
+	var signers []func() ([]ssh.Signer, error)
+	if agentClient != nil {
+		signers = append(signers, agentClient.Signers)
+	}
+	if privateKeyPath != "" {
+		signers = append(signers, func() ([]ssh.Signer, error) {
+			signer, err := loadPrivateKey(privateKeyPath)
+			if err != nil {
+				// A missing or unreadable key just means one less key to try
+				return nil, nil
+			}
+			return []ssh.Signer{signer}, nil
+		})
+	}
+
+	return []ssh.AuthMethod{
+		ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			var all []ssh.Signer
+			for _, get := range signers {
+				s, err := get()
+				if err == nil {
+					all = append(all, s...)
+				}
+			}
+			return all, nil
+		}),
+	}
+}
+
+// loadPrivateKey reads a private key, prompting for its passphrase if it is
+// encrypted.
+func loadPrivateKey(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		return signer, err
+	}
+
+	fmt.Fprintf(os.Stderr, "Enter passphrase for %s: ", path)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+}
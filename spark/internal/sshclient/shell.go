@@ -0,0 +1,83 @@
+package sshclient
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/t-eckert/homelab/spark/internal/terminal"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/term"
+)
+
+// Shell opens an interactive login shell on the connection, attached to the
+// local terminal. When forwardAgent is set and an SSH agent is available, it
+// is forwarded to the remote session.
+func (c *Client) Shell(forwardAgent bool) error {
+	session, err := c.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to open session: %w", err)
+	}
+	defer session.Close()
+
+	if forwardAgent && c.agent != nil {
+		if err := agent.ForwardToAgent(c.Client, c.agent); err != nil {
+			return fmt.Errorf("failed to set up agent forwarding: %w", err)
+		}
+		if err := agent.RequestAgentForwarding(session); err != nil {
+			return fmt.Errorf("failed to request agent forwarding: %w", err)
+		}
+	}
+
+	session.Stdin = os.Stdin
+	session.Stdout = os.Stdout
+	session.Stderr = os.Stderr
+
+	fd := int(os.Stdin.Fd())
+	if term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer term.Restore(fd, state)
+
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		termType := os.Getenv("TERM")
+		if termType == "" {
+			termType = "xterm-256color"
+		}
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          1,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty(termType, height, width, modes); err != nil {
+			return fmt.Errorf("failed to allocate pty: %w", err)
+		}
+
+		stop := terminal.WatchResize(fd, func(width, height int) {
+			_ = session.WindowChange(height, width)
+		})
+		defer stop()
+	}
+
+	if err := session.Shell(); err != nil {
+		return fmt.Errorf("failed to start shell: %w", err)
+	}
+
+	err = session.Wait()
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		// The shell exiting with the status of its last command is not a
+		// connection failure
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("connection lost: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package sshkeys
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/t-eckert/homelab/spark/internal/names"
+	"golang.org/x/crypto/ssh"
+)
+
+// AuthorizedKey is a public key allowed to log into a spark.
+type AuthorizedKey struct {
+	// Line is the key in authorized_keys format.
+	Line        string
+	Type        string
+	Fingerprint string
+	Comment     string
+}
+
+// ParseAuthorizedKey parses a single authorized_keys line.
+func ParseAuthorizedKey(line string) (AuthorizedKey, error) {
+	line = strings.TrimSpace(line)
+	pub, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+	if err != nil {
+		return AuthorizedKey{}, fmt.Errorf("invalid public key %q: %w", truncate(line, 40), err)
+	}
+	return AuthorizedKey{
+		Line:        line,
+		Type:        pub.Type(),
+		Fingerprint: ssh.FingerprintSHA256(pub),
+		Comment:     comment,
+	}, nil
+}
+
+// ParseAuthorizedKeys parses the contents of an authorized_keys file,
+// skipping blank lines and comments.
+func ParseAuthorizedKeys(data string) ([]AuthorizedKey, error) {
+	var keys []AuthorizedKey
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, err := ParseAuthorizedKey(line)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, scanner.Err()
+}
+
+// FormatAuthorizedKeys returns keys as the contents of an authorized_keys
+// file.
+func FormatAuthorizedKeys(keys []AuthorizedKey) string {
+	var b strings.Builder
+	for _, key := range keys {
+		b.WriteString(key.Line + "\n")
+	}
+	return b.String()
+}
+
+// MergeAuthorizedKeys appends the keys in add that are not already in keys,
+// comparing the keys themselves rather than their comments.
+func MergeAuthorizedKeys(keys []AuthorizedKey, add ...AuthorizedKey) []AuthorizedKey {
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		seen[key.Fingerprint] = true
+	}
+	for _, key := range add {
+		if !seen[key.Fingerprint] {
+			seen[key.Fingerprint] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// RemoveAuthorizedKeys removes the keys matching match, which is a
+// fingerprint, a comment or a whole key, and returns the remaining and
+// removed keys.
+func RemoveAuthorizedKeys(keys []AuthorizedKey, match string) (remaining, removed []AuthorizedKey) {
+	match = strings.TrimSpace(match)
+	matchFingerprint := ""
+	if key, err := ParseAuthorizedKey(match); err == nil {
+		matchFingerprint = key.Fingerprint
+	}
+
+	for _, key := range keys {
+		if key.Fingerprint == match || key.Fingerprint == matchFingerprint || (key.Comment != "" && key.Comment == match) {
+			removed = append(removed, key)
+		} else {
+			remaining = append(remaining, key)
+		}
+	}
+	return remaining, removed
+}
+
+// ReadAuthorizedKeysFile reads the public keys in a file, such as an
+// id_ed25519.pub or a teammate's authorized_keys.
+func ReadAuthorizedKeysFile(path string) ([]AuthorizedKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	keys, err := ParseAuthorizedKeys(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s contains no public keys", path)
+	}
+	return keys, nil
+}
+
+// FetchGitHubKeys returns the public keys of a GitHub user. GitHub publishes
+// them without comments, so each is commented github:<user> to make it
+// recognizable and removable.
+func FetchGitHubKeys(ctx context.Context, user string) ([]AuthorizedKey, error) {
+	if err := names.ValidateGitHubUser(user); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://github.com/"+user+".keys", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys for GitHub user %s: %w", user, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("GitHub user %s not found", user)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch keys for GitHub user %s: %s", user, resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch keys for GitHub user %s: %w", user, err)
+	}
+
+	var keys []AuthorizedKey
+	for _, line := range bytes.Split(body, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		if len(fields) < 2 {
+			continue
+		}
+		key, err := ParseAuthorizedKey(fmt.Sprintf("%s %s github:%s", fields[0], fields[1], user))
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("GitHub user %s has no public keys", user)
+	}
+	return keys, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
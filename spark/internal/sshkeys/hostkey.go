@@ -0,0 +1,43 @@
+package sshkeys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKey is an SSH host key pair for a spark's sshd.
+type HostKey struct {
+	// PrivateKey is the private key in OpenSSH PEM format, as written to
+	// /etc/ssh/ssh_host_ed25519_key.
+	PrivateKey string
+	// PublicKey is the public key in authorized_keys format.
+	PublicKey string
+}
+
+// GenerateHostKey creates a new ed25519 host key pair.
+func GenerateHostKey() (*HostKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate host key: %w", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host key: %w", err)
+	}
+
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode host public key: %w", err)
+	}
+
+	return &HostKey{
+		PrivateKey: string(pem.EncodeToMemory(block)),
+		PublicKey:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPublic))),
+	}, nil
+}
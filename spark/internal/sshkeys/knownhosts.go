@@ -0,0 +1,95 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KnownHostsPath returns the path of the user's OpenSSH known_hosts file.
+func KnownHostsPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
+}
+
+// AddKnownHost pins publicKey for host in the known_hosts file at path,
+// replacing any existing entries for that host.
+func AddKnownHost(path, host, publicKey string) error {
+	lines, err := readKnownHosts(path, host)
+	if err != nil {
+		return err
+	}
+	lines = append(lines, host+" "+strings.TrimSpace(publicKey))
+	return writeKnownHosts(path, lines)
+}
+
+// RemoveKnownHost removes every entry for host from the known_hosts file at
+// path.
+func RemoveKnownHost(path, host string) error {
+	lines, err := readKnownHosts(path, host)
+	if err != nil {
+		return err
+	}
+	return writeKnownHosts(path, lines)
+}
+
+// readKnownHosts returns the lines of the known_hosts file at path, leaving
+// out host. Lines listing other hosts too keep those. A missing file has no
+// lines.
+func readKnownHosts(path, host string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if line, ok := withoutHost(line, host); ok {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+func writeKnownHosts(path string, lines []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	data := strings.Join(lines, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// withoutHost removes host from the host list of a plain (unhashed)
+// known_hosts line, reporting false if no hosts remain.
+func withoutHost(line, host string) (string, bool) {
+	fields := strings.Fields(line)
+	// Comments and marker lines such as @revoked are never touched
+	if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "@") {
+		return line, true
+	}
+	hosts := strings.Split(fields[0], ",")
+	var kept []string
+	for _, h := range hosts {
+		if h != host {
+			kept = append(kept, h)
+		}
+	}
+	if len(kept) == len(hosts) {
+		return line, true
+	}
+	if len(kept) == 0 {
+		return "", false
+	}
+	// Keep the rest of the line, key and comment, as it was
+	rest := strings.TrimLeft(line, " \t")[len(fields[0]):]
+	return strings.Join(kept, ",") + rest, true
+}
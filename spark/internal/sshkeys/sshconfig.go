@@ -0,0 +1,153 @@
+package sshkeys
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Markers delimiting the block of ~/.ssh/config that spark manages.
+const (
+	managedBlockBegin = "# BEGIN spark managed block (edit with 'spark ssh-config')"
+	managedBlockEnd   = "# END spark managed block"
+)
+
+// HostEntry is a Host section in the managed block of ~/.ssh/config.
+type HostEntry struct {
+	Name         string
+	HostName     string
+	User         string
+	IdentityFile string
+	// HostKeyAlias is the name the host's key is pinned under in
+	// known_hosts.
+	HostKeyAlias string
+	// LocalForwards are LocalForward arguments, such as
+	// "3000 localhost:3000".
+	LocalForwards []string
+}
+
+// SSHConfigPath returns the path of the user's OpenSSH client config.
+func SSHConfigPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".ssh", "config")
+}
+
+// RenderManagedBlock returns the managed block holding entries, including
+// its delimiting markers.
+func RenderManagedBlock(entries []HostEntry) string {
+	var b strings.Builder
+	b.WriteString(managedBlockBegin + "\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "Host %s\n", entry.Name)
+		writeOption(&b, "HostName", entry.HostName)
+		writeOption(&b, "User", entry.User)
+		writeOption(&b, "IdentityFile", entry.IdentityFile)
+		writeOption(&b, "HostKeyAlias", entry.HostKeyAlias)
+		for _, forward := range entry.LocalForwards {
+			writeOption(&b, "LocalForward", forward)
+		}
+	}
+	// Reset the scope, so the config following the block is not applied to
+	// the last spark's Host section only
+	b.WriteString("Host *\n")
+	b.WriteString(managedBlockEnd + "\n")
+	return b.String()
+}
+
+func writeOption(b *strings.Builder, key, value string) {
+	if value != "" {
+		fmt.Fprintf(b, "  %s %s\n", key, value)
+	}
+}
+
+// ReadManagedBlock returns the entries in the managed block of the config at
+// path, and whether the block exists.
+func ReadManagedBlock(path string) ([]HostEntry, bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	_, block, _, found := splitManagedBlock(string(data))
+	if !found {
+		return nil, false, nil
+	}
+
+	var entries []HostEntry
+	for _, line := range strings.Split(block, "\n") {
+		key, value, _ := strings.Cut(strings.TrimSpace(line), " ")
+		value = strings.TrimSpace(value)
+		if key == "Host" && value != "*" {
+			entries = append(entries, HostEntry{Name: value})
+			continue
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		entry := &entries[len(entries)-1]
+		switch key {
+		case "HostName":
+			entry.HostName = value
+		case "User":
+			entry.User = value
+		case "IdentityFile":
+			entry.IdentityFile = value
+		case "HostKeyAlias":
+			entry.HostKeyAlias = value
+		case "LocalForward":
+			entry.LocalForwards = append(entry.LocalForwards, value)
+		}
+	}
+	return entries, true, nil
+}
+
+// WriteManagedBlock replaces the managed block of the config at path with
+// entries, prepending the block if the config does not have one yet. Content
+// outside the block is left untouched.
+func WriteManagedBlock(path string, entries []HostEntry) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	before, _, after, found := splitManagedBlock(string(data))
+	if !found {
+		// Prepended, since ssh uses the first value it finds for an option
+		// and a "Host *" section earlier in the config would otherwise win
+		before, after = "", string(data)
+		if after != "" {
+			after = "\n" + after
+		}
+	}
+
+	content := before + RenderManagedBlock(entries) + after
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// splitManagedBlock splits config into the text before the managed block,
+// the lines inside it and the text after it.
+func splitManagedBlock(config string) (before, block, after string, found bool) {
+	start := strings.Index(config, managedBlockBegin)
+	if start == -1 {
+		return config, "", "", false
+	}
+	rest := config[start+len(managedBlockBegin):]
+	end := strings.Index(rest, managedBlockEnd)
+	if end == -1 {
+		return config, "", "", false
+	}
+
+	after = rest[end+len(managedBlockEnd):]
+	after = strings.TrimPrefix(after, "\n")
+	return config[:start], rest[:end], after, true
+}
@@ -0,0 +1,334 @@
+// Package templates loads spark templates, YAML profiles describing the
+// environment a spark is created with.
+package templates
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Default is the template sparks are created from when none is given.
+const Default = "default"
+
+// RepoPrefix starts the names of the templates in the enclosing
+// repository's .spark/templates. Their database seeds run against the shared
+// Postgres server, so they are only used when named, and never hide the
+// built-in or user templates.
+const RepoPrefix = "repo:"
+
+//go:embed builtin/*.yaml
+var builtin embed.FS
+
+// Template describes a spark's environment, loaded from a YAML file such as:
+//
+//	description: Go API service
+//	extends: default         # start from another template
+//	image: debian:bookworm   # base image
+//	packages: [jq]           # extra packages, by their Debian names
+//	runtimes:                # language runtimes and tools, installed with mise
+//	  go: "1.23"
+//	env:
+//	  CGO_ENABLED: "0"
+//	resources:
+//	  cpu: "2"
+//	  memory: 4Gi
+//	storage: 20Gi
+//	addons: [redis]          # sidecar services
+//	dbSeeds: [seed.sql]      # SQL run against the spark's database
+//	postCreate:              # run as the spark user on first boot
+//	  - go install golang.org/x/tools/gopls@latest
+//
+// Lists and maps are merged with those of the extended template, and other
+// fields override it.
+type Template struct {
+	// Name is the template's file name without its extension.
+	Name string `yaml:"-"`
+	// Source is where the template was loaded from: "builtin" or a path.
+	Source string `yaml:"-"`
+	// Hides is the source of the template of the same name this one hides,
+	// if any.
+	Hides string `yaml:"-"`
+	// Overrides are the templates merged into a resolved template that hide
+	// a built-in one, as "name (source)".
+	Overrides []string `yaml:"-"`
+
+	Description string            `yaml:"description,omitempty"`
+	Extends     string            `yaml:"extends,omitempty"`
+	Image       string            `yaml:"image,omitempty"`
+	Packages    []string          `yaml:"packages,omitempty"`
+	Runtimes    map[string]string `yaml:"runtimes,omitempty"`
+	Env         map[string]string `yaml:"env,omitempty"`
+	Resources   Resources         `yaml:"resources,omitempty"`
+	Storage     string            `yaml:"storage,omitempty"`
+	Addons      []string          `yaml:"addons,omitempty"`
+	// DBSeeds are SQL files, relative to the template file unless absolute.
+	DBSeeds    []string `yaml:"dbSeeds,omitempty"`
+	PostCreate []string `yaml:"postCreate,omitempty"`
+
+	// seeds holds DBSeeds resolved against the file system of the template
+	// that listed them, which differs from this one's when extending.
+	seeds []seed
+}
+
+// Resources are the CPU and memory limits of a spark's container.
+type Resources struct {
+	CPU    string `yaml:"cpu,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+// Seed is a SQL script run against a spark's database after it is created.
+type Seed struct {
+	Name string
+	SQL  string
+}
+
+type seed struct {
+	fsys fs.FS
+	path string
+}
+
+// source is a directory of template files.
+type source struct {
+	name string
+	fsys fs.FS
+	dir  string
+	// prefix starts the names of the source's templates.
+	prefix string
+}
+
+// sources returns the directories templates are loaded from, from lowest to
+// highest precedence: the built-in templates, ~/.config/spark/templates and
+// .spark/templates in the enclosing repository, whose names are prefixed
+// with RepoPrefix.
+func sources(configDir string) []source {
+	sources := []source{{name: "builtin", fsys: builtin, dir: "builtin"}}
+
+	userDir := filepath.Join(configDir, "templates")
+	sources = append(sources, source{name: userDir, fsys: os.DirFS(userDir), dir: "."})
+
+	if root := repoRoot(); root != "" {
+		repoDir := filepath.Join(root, ".spark", "templates")
+		sources = append(sources, source{name: repoDir, fsys: os.DirFS(repoDir), dir: ".", prefix: RepoPrefix})
+	}
+	return sources
+}
+
+// repoRoot returns the root of the git repository containing the working
+// directory, or an empty string outside of one.
+func repoRoot() string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	for dir := wd; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// List returns the available templates by name. A user template hides a
+// built-in one of the same name, recording it in Hides.
+func List(configDir string) ([]*Template, error) {
+	found := make(map[string]*Template)
+	for _, src := range sources(configDir) {
+		entries, err := fs.ReadDir(src.fsys, src.dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read templates from %s: %w", src.name, err)
+		}
+		for _, entry := range entries {
+			name, ok := templateName(entry.Name())
+			if !ok || entry.IsDir() {
+				continue
+			}
+			t, err := parse(src, entry.Name(), src.prefix+name)
+			if err != nil {
+				return nil, err
+			}
+			if hidden, ok := found[t.Name]; ok {
+				t.Hides = hidden.Source
+			}
+			found[t.Name] = t
+		}
+	}
+
+	templates := make([]*Template, 0, len(found))
+	for _, t := range found {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+	return templates, nil
+}
+
+// Load returns the named template with the templates it extends merged in.
+func Load(configDir, name string) (*Template, error) {
+	templates, err := List(configDir)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*Template, len(templates))
+	for _, t := range templates {
+		byName[t.Name] = t
+	}
+
+	var chain []*Template
+	seen := make(map[string]bool)
+	for next := name; next != ""; {
+		if seen[next] {
+			return nil, fmt.Errorf("template %s extends itself through %s", name, chain[len(chain)-1].Name)
+		}
+		seen[next] = true
+
+		t, ok := byName[next]
+		if !ok {
+			if next == name {
+				return nil, fmt.Errorf("template %s not found; see 'spark templates list'", name)
+			}
+			return nil, fmt.Errorf("template %s extends unknown template %s", chain[len(chain)-1].Name, next)
+		}
+		chain = append(chain, t)
+		next = t.Extends
+	}
+
+	resolved := &Template{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		resolved.merge(chain[i])
+		if chain[i].Hides != "" {
+			resolved.Overrides = append(resolved.Overrides, fmt.Sprintf("%s (%s)", chain[i].Name, chain[i].Source))
+		}
+	}
+	resolved.Name = name
+	resolved.Source = chain[0].Source
+	resolved.Description = chain[0].Description
+	resolved.Extends = chain[0].Extends
+	return resolved, nil
+}
+
+// templateName returns the template name of a file, if it is a YAML file.
+func templateName(file string) (string, bool) {
+	for _, ext := range []string{".yaml", ".yml"} {
+		if strings.HasSuffix(file, ext) {
+			return strings.TrimSuffix(file, ext), true
+		}
+	}
+	return "", false
+}
+
+func parse(src source, file, name string) (*Template, error) {
+	p := path.Join(src.dir, file)
+	data, err := fs.ReadFile(src.fsys, p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template %s: %w", name, err)
+	}
+
+	location := src.name
+	if src.name != "builtin" {
+		location = filepath.Join(src.name, file)
+	}
+
+	t := &Template{Name: name, Source: location}
+	if err := yaml.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse template %s: %w", location, err)
+	}
+	for _, s := range t.DBSeeds {
+		if filepath.IsAbs(s) {
+			t.seeds = append(t.seeds, seed{fsys: os.DirFS(filepath.Dir(s)), path: filepath.Base(s)})
+		} else {
+			t.seeds = append(t.seeds, seed{fsys: src.fsys, path: path.Join(src.dir, filepath.ToSlash(s))})
+		}
+	}
+	return t, nil
+}
+
+// merge applies t on top of the template being resolved.
+func (r *Template) merge(t *Template) {
+	if t.Image != "" {
+		r.Image = t.Image
+	}
+	r.Packages = appendUnique(r.Packages, t.Packages...)
+	r.Runtimes = MergeMap(r.Runtimes, t.Runtimes)
+	r.Env = MergeMap(r.Env, t.Env)
+	if t.Resources.CPU != "" {
+		r.Resources.CPU = t.Resources.CPU
+	}
+	if t.Resources.Memory != "" {
+		r.Resources.Memory = t.Resources.Memory
+	}
+	if t.Storage != "" {
+		r.Storage = t.Storage
+	}
+	r.Addons = appendUnique(r.Addons, t.Addons...)
+	r.DBSeeds = append(r.DBSeeds, t.DBSeeds...)
+	r.seeds = append(r.seeds, t.seeds...)
+	r.PostCreate = append(r.PostCreate, t.PostCreate...)
+}
+
+// Seeds reads the template's database seeds, in order.
+func (t *Template) Seeds() ([]Seed, error) {
+	seeds := make([]Seed, 0, len(t.seeds))
+	for i, s := range t.seeds {
+		data, err := fs.ReadFile(s.fsys, s.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read database seed %s: %w", t.DBSeeds[i], err)
+		}
+		seeds = append(seeds, Seed{Name: t.DBSeeds[i], SQL: string(data)})
+	}
+	return seeds, nil
+}
+
+// YAML returns the template as YAML.
+func (t *Template) YAML() (string, error) {
+	data, err := yaml.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		found := false
+		for _, existing := range list {
+			if existing == item {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// MergeMap returns base with the entries of override added, without
+// modifying either. It returns base itself if override is empty.
+func MergeMap(base, override map[string]string) map[string]string {
+	if len(override) == 0 {
+		return base
+	}
+	merged := make(map[string]string, len(base)+len(override))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
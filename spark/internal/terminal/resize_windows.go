@@ -0,0 +1,8 @@
+//go:build windows
+
+package terminal
+
+// WatchResize is a no-op on Windows, which has no SIGWINCH.
+func WatchResize(fd int, onResize func(width, height int)) (stop func()) {
+	return func() {}
+}